@@ -0,0 +1,473 @@
+package dockercompose
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	goos "os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type BuildContextFile struct {
+	Contents []byte
+	Mode     goos.FileMode
+}
+
+type BuildContext map[string]BuildContextFile
+
+type ServiceBuild struct {
+	Dockerfile     string
+	Context        BuildContext
+	ContextPath    string
+	DockerfilePath string
+	Args           map[string]string
+	Target         string
+}
+
+func (b *ServiceBuild) MarshalYAML() (interface{}, error) {
+	return struct {
+		Context    string            `yaml:"context"`
+		Dockerfile string            `yaml:"dockerfile,omitempty"`
+		Args       map[string]string `yaml:"args,omitempty"`
+		Target     string            `yaml:"target,omitempty"`
+	}{b.ContextPath, b.DockerfilePath, b.Args, b.Target}, nil
+}
+
+const (
+	projectLabel     = "com.github.seppo0010.vortices-dockercompose.project"
+	contentHashLabel = "com.github.seppo0010.vortices-dockercompose.content-hash"
+)
+
+type BuildOptions struct {
+	Tags      []string
+	BuildArgs map[string]string
+	Target    string
+	Labels    map[string]string
+	NoCache   bool
+	Pull      bool
+	Platform  string
+	Progress  func(BuildProgress)
+}
+
+type BuildProgress struct {
+	Name       string
+	Line       string
+	Step       int
+	TotalSteps int
+}
+
+var buildStepRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`^Step (\d+)/(\d+) :`),
+	regexp.MustCompile(`^#\d+ \[(?:[^\]]* )?(\d+)/(\d+)\]`),
+}
+
+func parseBuildProgress(name, line string) BuildProgress {
+	progress := BuildProgress{Name: name, Line: line}
+	for _, stepRegexp := range buildStepRegexps {
+		if submatches := stepRegexp.FindStringSubmatch(line); submatches != nil {
+			progress.Step, _ = strconv.Atoi(submatches[1])
+			progress.TotalSteps, _ = strconv.Atoi(submatches[2])
+			break
+		}
+	}
+	return progress
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Compose) buildArgs(iidPath, dirPath string, options BuildOptions) []string {
+	args := []string{"build", "--iidfile", iidPath}
+	for _, tag := range options.Tags {
+		args = append(args, "--tag", tag)
+	}
+	for _, key := range sortedKeys(options.BuildArgs) {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, options.BuildArgs[key]))
+	}
+	labels := map[string]string{}
+	for key, value := range options.Labels {
+		labels[key] = value
+	}
+	if !cacheable(options) {
+		labels[projectLabel] = c.id
+	}
+	for _, key := range sortedKeys(labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if options.Pull {
+		args = append(args, "--pull")
+	}
+	if options.Platform != "" {
+		args = append(args, "--platform", options.Platform)
+	}
+	return append(args, dirPath)
+}
+
+func (c *Compose) BuildDockerPath(name, dirPath string) (string, error) {
+	return c.BuildDockerPathWithOptions(name, dirPath, BuildOptions{})
+}
+
+func (c *Compose) BuildDockerPathWithOptions(name, dirPath string, options BuildOptions) (string, error) {
+	if !c.os.FileExists(dirPath) {
+		return "", fmt.Errorf("path %s does not exist", dirPath)
+	}
+
+	log.Infof("starting to build docker image %s", name)
+	defer log.Infof("finished building docker image %s", name)
+
+	iidPath := path.Join(c.os.TempDir(), fmt.Sprintf("vortices-dockercompose-%s.iid", uuid.New().String()))
+	defer c.os.RemoveAll(iidPath)
+
+	cmd := c.exec.New("docker", c.buildArgs(iidPath, dirPath, options)...)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to pipe docker build stdout at path %s: %s", dirPath, err.Error())
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to pipe docker build stderr at path %s: %s", dirPath, err.Error())
+	}
+	if err = cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to build docker image at path %s: %s", dirPath, err.Error())
+	}
+
+	var stdout, stderr bytes.Buffer
+	var progressMutex sync.Mutex
+	collect := func(buffer *bytes.Buffer) func(string) {
+		return func(line string) {
+			buffer.WriteString(line + "\n")
+			if options.Progress != nil {
+				progressMutex.Lock()
+				defer progressMutex.Unlock()
+				options.Progress(parseBuildProgress(name, line))
+			}
+		}
+	}
+	stderrRead := make(chan struct{})
+	go func() {
+		streamLines(stderrPipe, collect(&stderr))
+		close(stderrRead)
+	}()
+	streamLines(stdoutPipe, collect(&stdout))
+	<-stderrRead
+	if err = cmd.Wait(); err != nil {
+		return "", fmt.Errorf("failed to build docker image at path %s: %s\n%s", dirPath, err.Error(), stderr.String())
+	}
+	out := stdout.String()
+
+	image := ""
+	if iid, err := c.os.ReadFile(iidPath); err == nil {
+		image = strings.TrimSpace(string(iid))
+	}
+	if image == "" {
+		submatches := regexp.MustCompile(`Successfully built ([a-fA-F0-9]*)`).FindStringSubmatch(out)
+		if len(submatches) == 0 {
+			submatches = regexp.MustCompile(`writing image (sha256:[a-fA-F0-9]+)`).FindStringSubmatch(stderr.String())
+		}
+		if len(submatches) == 0 {
+			return "", fmt.Errorf("could not find docker image tag. Full output:\n%s%s", out, stderr.String())
+		}
+		image = submatches[1]
+	}
+	image, err = c.fullImageID(image)
+	if err != nil {
+		return "", err
+	}
+	return c.trackImage(image, options), nil
+}
+
+var fullImageIDRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+func (c *Compose) fullImageID(image string) (string, error) {
+	if fullImageIDRegexp.MatchString("sha256:" + image) {
+		image = "sha256:" + image
+	}
+	if fullImageIDRegexp.MatchString(image) {
+		return image, nil
+	}
+	stdout, err := c.exec.New("docker", "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve docker image id %s: %s", image, err.Error())
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+func cacheable(options BuildOptions) bool {
+	_, found := options.Labels[contentHashLabel]
+	return found
+}
+
+func (c *Compose) trackImage(image string, options BuildOptions) string {
+	if cacheable(options) {
+		return image
+	}
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	c.builtImages = append(c.builtImages, image)
+	return image
+}
+
+func (c *Compose) BuiltImages() []string {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	return append([]string{}, c.builtImages...)
+}
+
+func (c *Compose) BuildDocker(name, script string) (string, error) {
+	return c.buildDocker(name, script, uuid.New().String())
+}
+
+func (c *Compose) buildDocker(name, script, uuidString string) (string, error) {
+	return c.buildDockerContext(name, BuildContext{"Dockerfile": BuildContextFile{Contents: []byte(script)}}, BuildOptions{}, uuidString)
+}
+
+func (c *Compose) BuildDockerContext(name string, context BuildContext) (string, error) {
+	return c.BuildDockerContextWithOptions(name, context, BuildOptions{})
+}
+
+func (c *Compose) BuildDockerContextWithOptions(name string, context BuildContext, options BuildOptions) (string, error) {
+	return c.buildDockerContext(name, context, options, uuid.New().String())
+}
+
+func (c *Compose) buildDockerContext(name string, context BuildContext, options BuildOptions, uuidString string) (string, error) {
+	if _, found := context["Dockerfile"]; !found {
+		return "", fmt.Errorf("build context for %s has no Dockerfile", name)
+	}
+
+	dirPath := path.Join(c.os.TempDir(), uuidString)
+	err := c.os.MkdirAll(dirPath, 0744)
+	if err != nil {
+		return "", err
+	}
+	defer c.os.RemoveAll(dirPath)
+
+	err = c.writeBuildContext(dirPath, context)
+	if err != nil {
+		return "", err
+	}
+
+	return c.BuildDockerPathWithOptions(name, dirPath, options)
+}
+
+func (c *Compose) writeBuildContext(dirPath string, context BuildContext) error {
+	names := make([]string, 0, len(context))
+	for name := range context {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cleanName := path.Clean(name)
+		if path.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, "../") {
+			return fmt.Errorf("build context path %s is outside the context", name)
+		}
+		filePath := path.Join(dirPath, cleanName)
+		err := c.os.MkdirAll(path.Dir(filePath), 0744)
+		if err != nil {
+			return err
+		}
+		f, err := c.os.Create(filePath)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(context[name].Contents)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+		if mode := context[name].Mode; mode != 0 {
+			err = c.os.Chmod(filePath, mode)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func serviceBuildDir(name string) string {
+	return path.Join("build", name)
+}
+
+func (c *Compose) writeServiceBuilds() (bool, error) {
+	names := make([]string, 0, len(c.Services))
+	for name, service := range c.Services {
+		if service.Build != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		build := c.Services[name].Build
+		if build.ContextPath != "" {
+			continue
+		}
+		context := BuildContext{}
+		for filePath, file := range build.Context {
+			context[filePath] = file
+		}
+		if build.Dockerfile != "" {
+			context["Dockerfile"] = BuildContextFile{Contents: []byte(build.Dockerfile)}
+		}
+		if _, found := context["Dockerfile"]; !found {
+			return false, fmt.Errorf("build for service %s has no Dockerfile", name)
+		}
+
+		dirPath := path.Join(c.getTmpDir(), serviceBuildDir(name))
+		err := c.os.MkdirAll(dirPath, 0744)
+		if err != nil {
+			return false, err
+		}
+		err = c.writeBuildContext(dirPath, context)
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(names) > 0, nil
+}
+
+type BuildRequest struct {
+	Name    string
+	Context BuildContext
+	Options BuildOptions
+}
+
+type BuildResult struct {
+	Name   string
+	Image  string
+	Cached bool
+	Err    error
+}
+
+func contentHash(context BuildContext, options BuildOptions) string {
+	hash := sha256.New()
+	names := make([]string, 0, len(context))
+	for name := range context {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := context[name]
+		fmt.Fprintf(hash, "file %q %o %d\n", path.Clean(name), file.Mode, len(file.Contents))
+		hash.Write(file.Contents)
+	}
+	for _, key := range sortedKeys(options.BuildArgs) {
+		fmt.Fprintf(hash, "arg %q %q\n", key, options.BuildArgs[key])
+	}
+	for _, key := range sortedKeys(options.Labels) {
+		fmt.Fprintf(hash, "label %q %q\n", key, options.Labels[key])
+	}
+	fmt.Fprintf(hash, "target %q\nplatform %q\n", options.Target, options.Platform)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *Compose) listImagesByLabel(key, value string) ([]string, error) {
+	stdout, err := c.exec.New("docker", "images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", key, value)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list docker images with label %s=%s: %s", key, value, err.Error())
+	}
+	images := []string{}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			images = append(images, line)
+		}
+	}
+	return images, nil
+}
+
+func (c *Compose) findImageByLabel(key, value string) (string, error) {
+	images, err := c.listImagesByLabel(key, value)
+	if err != nil || len(images) == 0 {
+		return "", err
+	}
+	return images[0], nil
+}
+
+func (c *Compose) buildCached(request BuildRequest) BuildResult {
+	result := BuildResult{Name: request.Name}
+	hash := contentHash(request.Context, request.Options)
+	if !request.Options.NoCache {
+		image, err := c.findImageByLabel(contentHashLabel, hash)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		if image != "" {
+			log.Infof("reusing docker image %s for %s", image, request.Name)
+			for _, tag := range request.Options.Tags {
+				if _, err := c.exec.New("docker", "tag", image, tag).Output(); err != nil {
+					result.Err = fmt.Errorf("failed to tag docker image %s as %s: %s", image, tag, err.Error())
+					return result
+				}
+			}
+			result.Image = image
+			result.Cached = true
+			return result
+		}
+	}
+
+	options := request.Options
+	options.Labels = map[string]string{}
+	for key, value := range request.Options.Labels {
+		options.Labels[key] = value
+	}
+	options.Labels[contentHashLabel] = hash
+	result.Image, result.Err = c.BuildDockerContextWithOptions(request.Name, request.Context, options)
+	return result
+}
+
+func (c *Compose) BuildAll(requests []BuildRequest, workers int) ([]BuildResult, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]BuildResult, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = c.buildCached(requests[index])
+			}
+		}()
+	}
+	for index := range requests {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Err != nil {
+			return results, fmt.Errorf("failed to build %s: %s", result.Name, result.Err.Error())
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,368 @@
+package dockercompose
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	goos "os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectBuild(fakeExec *exec.FakeCommander, shortID string) string {
+	fullID := "sha256:" + shortID + strings.Repeat("0", 64-len(shortID))
+	fakeExec.Expect("docker", exec.ArgsPrefix("build")).Stdout("Successfully built " + shortID + "\n")
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", shortID)).Stdout(fullID + "\n")
+	return fullID
+}
+
+func TestBuildDockerIIDFile(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	iid := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	var iidPath string
+	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
+		iidPath = cmd.Args[2]
+		f, err := fakeOS.Create(iidPath)
+		if err != nil {
+			return err
+		}
+		f.Write([]byte(iid + "\n"))
+		return f.Close()
+	}
+	fakeExec.StdoutHandler = func(cmd *exec.FakeCmd) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	fakeExec.StderrHandler = func(cmd *exec.FakeCmd) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("#5 exporting to image\n#5 writing image " + iid + " done\n#5 DONE 0.0s\n")), nil
+	}
+	img, err := compose.BuildDocker("ubuntu copy", "FROM ubuntu\nRUN echo 1 > /a")
+	assert.Nil(t, err)
+	assert.Equal(t, img, iid)
+	assert.False(t, fakeOS.FileExists(iidPath))
+}
+
+func TestBuildDockerContext(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	var script []byte
+	var scriptInfo goos.FileInfo
+	var config []byte
+	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
+		var err error
+		if script, err = fakeOS.ReadFile("/tmp/buildme/run.sh"); err != nil {
+			return err
+		}
+		if scriptInfo, err = fakeOS.Stat("/tmp/buildme/run.sh"); err != nil {
+			return err
+		}
+		config, err = fakeOS.ReadFile("/tmp/buildme/conf/app.conf")
+		return err
+	}
+	fakeExec.StdoutHandler = func(cmd *exec.FakeCmd) (io.ReadCloser, error) {
+		if cmd.Args[0] == "image" {
+			return ioutil.NopCloser(strings.NewReader("sha256:0123456789ab" + strings.Repeat("0", 52) + "\n")), nil
+		}
+		return ioutil.NopCloser(strings.NewReader("Successfully built 0123456789ab\n")), nil
+	}
+	img, err := compose.buildDockerContext("app", BuildContext{
+		"Dockerfile":    BuildContextFile{Contents: []byte("FROM ubuntu\nCOPY . /app\nRUN /app/run.sh")},
+		"run.sh":        BuildContextFile{Contents: []byte("#!/bin/sh\necho hi\n"), Mode: 0755},
+		"conf/app.conf": BuildContextFile{Contents: []byte("debug=true\n")},
+	}, BuildOptions{}, "buildme")
+	assert.Nil(t, err)
+	assert.Equal(t, img, "sha256:0123456789ab"+strings.Repeat("0", 52))
+	assert.Equal(t, string(script), "#!/bin/sh\necho hi\n")
+	assert.Equal(t, scriptInfo.Mode(), goos.FileMode(0755))
+	assert.Equal(t, string(config), "debug=true\n")
+	assert.False(t, fakeOS.FileExists("/tmp/buildme"))
+}
+
+func TestBuildDockerContextInvalid(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.AnyArgs()).Times(0)
+
+	_, err := compose.BuildDockerContext("app", BuildContext{"run.sh": BuildContextFile{}})
+	assert.Equal(t, err.Error(), "build context for app has no Dockerfile")
+
+	_, err = compose.BuildDockerContext("app", BuildContext{
+		"Dockerfile":    BuildContextFile{Contents: []byte("FROM ubuntu")},
+		"../etc/passwd": BuildContextFile{},
+	})
+	assert.Equal(t, err.Error(), "build context path ../etc/passwd is outside the context")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestBuildDockerOptions(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.MkdirAll("/tmp/app", 0744)
+	built := expectBuild(fakeExec, "0123456789ab")
+	img, err := compose.BuildDockerPathWithOptions("app", "/tmp/app", BuildOptions{
+		Tags:      []string{"app:latest", "app:1"},
+		BuildArgs: map[string]string{"VERSION": "1", "DEBUG": "true"},
+		Target:    "runtime",
+		Labels:    map[string]string{"team": "vortices"},
+		NoCache:   true,
+		Pull:      true,
+		Platform:  "linux/amd64",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, img, built)
+	fakeExec.AssertExpectations(t)
+
+	args := compose.buildArgs("/tmp/app.iid", "/tmp/app", BuildOptions{
+		Tags:      []string{"app:latest", "app:1"},
+		BuildArgs: map[string]string{"VERSION": "1", "DEBUG": "true"},
+		Target:    "runtime",
+		Labels:    map[string]string{"team": "vortices", projectLabel: "other"},
+		NoCache:   true,
+		Pull:      true,
+		Platform:  "linux/amd64",
+	})
+	assert.Equal(t, args, []string{
+		"build", "--iidfile", "/tmp/app.iid",
+		"--tag", "app:latest", "--tag", "app:1",
+		"--build-arg", "DEBUG=true", "--build-arg", "VERSION=1",
+		"--label", fmt.Sprintf("%s=%s", projectLabel, compose.id), "--label", "team=vortices",
+		"--target", "runtime",
+		"--no-cache",
+		"--pull",
+		"--platform", "linux/amd64",
+		"/tmp/app",
+	})
+}
+
+func TestStartServiceBuild(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "--build"))
+	compose.AddService("peer", ServiceConfig{
+		Build: &ServiceBuild{
+			Dockerfile: "FROM ubuntu\nCOPY run.sh /\nARG VERSION\n",
+			Context:    BuildContext{"run.sh": BuildContextFile{Contents: []byte("#!/bin/sh\n"), Mode: 0755}},
+			Args:       map[string]string{"VERSION": "1"},
+		},
+	}, nil)
+	err := compose.Start()
+	assert.Nil(t, err)
+	fakeExec.AssertExpectations(t)
+
+	dockerfile, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "build", "peer", "Dockerfile"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(dockerfile), "FROM ubuntu\nCOPY run.sh /\nARG VERSION\n")
+	info, err := fakeOS.Stat(path.Join(compose.getTmpDir(), "build", "peer", "run.sh"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode(), goos.FileMode(0755))
+
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), `version: "2.1"
+services:
+  peer:
+    privileged: false
+    build:
+      context: ./build/peer
+      args:
+        VERSION: "1"
+    container_name: peer
+    networks: {}
+networks: {}
+`)
+}
+
+func TestStartServiceBuildNoDockerfile(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("peer", ServiceConfig{Build: &ServiceBuild{}}, nil)
+	err := compose.Start()
+	assert.Equal(t, err.Error(), "invalid compose topology: service peer: build has no Dockerfile")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestContentHash(t *testing.T) {
+	context := BuildContext{
+		"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu")},
+		"run.sh":     BuildContextFile{Contents: []byte("#!/bin/sh"), Mode: 0755},
+	}
+	hash := contentHash(context, BuildOptions{})
+	assert.Equal(t, hash, contentHash(BuildContext{
+		"run.sh":     BuildContextFile{Contents: []byte("#!/bin/sh"), Mode: 0755},
+		"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu")},
+	}, BuildOptions{Tags: []string{"ignored"}, NoCache: true}))
+	assert.NotEqual(t, hash, contentHash(BuildContext{
+		"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu")},
+		"run.sh":     BuildContextFile{Contents: []byte("#!/bin/sh"), Mode: 0644},
+	}, BuildOptions{}))
+	assert.NotEqual(t, hash, contentHash(context, BuildOptions{BuildArgs: map[string]string{"A": "1"}}))
+	assert.NotEqual(t, hash, contentHash(context, BuildOptions{Target: "runtime"}))
+}
+
+func TestBuildAll(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	cachedContext := BuildContext{"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu\nRUN echo cached")}}
+	freshContext := BuildContext{"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu\nRUN echo fresh")}}
+	cachedHash := contentHash(cachedContext, BuildOptions{})
+	freshHash := contentHash(freshContext, BuildOptions{})
+
+	fakeExec.Expect("docker", exec.ExactArgs("images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", contentHashLabel, cachedHash))).Stdout("sha256:cached\n")
+	fakeExec.Expect("docker", exec.ExactArgs("images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", contentHashLabel, freshHash))).Stdout("")
+	fakeExec.Expect("docker", exec.ExactArgs("tag", "sha256:cached", "cached:latest"))
+	fresh := expectBuild(fakeExec, "f5e5f5e5f5e5")
+
+	results, err := compose.BuildAll([]BuildRequest{
+		BuildRequest{Name: "cached", Context: cachedContext, Options: BuildOptions{Tags: []string{"cached:latest"}}},
+		BuildRequest{Name: "fresh", Context: freshContext},
+	}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, results, []BuildResult{
+		BuildResult{Name: "cached", Image: "sha256:cached", Cached: true},
+		BuildResult{Name: "fresh", Image: fresh},
+	})
+	fakeExec.AssertExpectations(t)
+}
+
+func TestBuildAllWorkers(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	var mutex sync.Mutex
+	running := 0
+	maxRunning := 0
+	builds := 0
+	overlapping := make(chan struct{})
+	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
+		if cmd.Args[0] != "build" {
+			return nil
+		}
+		mutex.Lock()
+		running++
+		builds++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if running == 2 && builds == 2 {
+			close(overlapping)
+		}
+		mutex.Unlock()
+		select {
+		case <-overlapping:
+		case <-time.After(5 * time.Second):
+		}
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return nil
+	}
+	fakeExec.StdoutHandler = func(cmd *exec.FakeCmd) (io.ReadCloser, error) {
+		if cmd.Args[0] == "build" {
+			return ioutil.NopCloser(strings.NewReader("Successfully built abcdef\n")), nil
+		}
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	requests := []BuildRequest{}
+	for i := 0; i < 6; i++ {
+		requests = append(requests, BuildRequest{
+			Name:    fmt.Sprintf("peer%d", i),
+			Context: BuildContext{"Dockerfile": BuildContextFile{Contents: []byte(fmt.Sprintf("FROM ubuntu\nRUN echo %d", i))}},
+		})
+	}
+	results, err := compose.BuildAll(requests, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, len(results), 6)
+	assert.Equal(t, builds, 6)
+	assert.Equal(t, maxRunning, 2)
+}
+
+func TestBuildAllFails(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ArgsPrefix("images")).Stdout("")
+	fakeExec.Expect("docker", exec.ArgsPrefix("build")).Stderr("no such image\n").ExitCode(1)
+
+	results, err := compose.BuildAll([]BuildRequest{
+		BuildRequest{Name: "broken", Context: BuildContext{"Dockerfile": BuildContextFile{Contents: []byte("FROM missing")}}},
+	}, 4)
+	assert.NotNil(t, err)
+	assert.Regexp(t, "^failed to build broken: ", err.Error())
+	assert.NotNil(t, results[0].Err)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestParseBuildProgress(t *testing.T) {
+	assert.Equal(t, parseBuildProgress("app", "Step 2/5 : RUN make"), BuildProgress{Name: "app", Line: "Step 2/5 : RUN make", Step: 2, TotalSteps: 5})
+	assert.Equal(t, parseBuildProgress("app", "#6 [2/3] RUN make"), BuildProgress{Name: "app", Line: "#6 [2/3] RUN make", Step: 2, TotalSteps: 3})
+	assert.Equal(t, parseBuildProgress("app", "#9 [builder 4/7] COPY . ."), BuildProgress{Name: "app", Line: "#9 [builder 4/7] COPY . .", Step: 4, TotalSteps: 7})
+	assert.Equal(t, parseBuildProgress("app", "#6 0.245 compiling"), BuildProgress{Name: "app", Line: "#6 0.245 compiling"})
+}
+
+func TestBuildDockerProgress(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.MkdirAll("/tmp/app", 0744)
+	fakeExec.Expect("docker", exec.ArgsPrefix("build")).
+		Stdout("Step 1/2 : FROM ubuntu\n ---> 1d622ef86b13\nStep 2/2 : RUN make\n ---> Running in 4a2b\nSuccessfully built 4a2b4a2b4a2b\n")
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "4a2b4a2b4a2b")).Stdout("sha256:4a2b4a2b4a2b" + strings.Repeat("0", 52) + "\n")
+
+	progress := []BuildProgress{}
+	img, err := compose.BuildDockerPathWithOptions("app", "/tmp/app", BuildOptions{
+		Progress: func(p BuildProgress) {
+			progress = append(progress, p)
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, img, "sha256:4a2b4a2b4a2b"+strings.Repeat("0", 52))
+	assert.Equal(t, progress, []BuildProgress{
+		BuildProgress{Name: "app", Line: "Step 1/2 : FROM ubuntu", Step: 1, TotalSteps: 2},
+		BuildProgress{Name: "app", Line: " ---> 1d622ef86b13"},
+		BuildProgress{Name: "app", Line: "Step 2/2 : RUN make", Step: 2, TotalSteps: 2},
+		BuildProgress{Name: "app", Line: " ---> Running in 4a2b"},
+		BuildProgress{Name: "app", Line: "Successfully built 4a2b4a2b4a2b"},
+	})
+	fakeExec.AssertExpectations(t)
+}
+
+func TestBuildDockerProgressBuildKit(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.MkdirAll("/tmp/app", 0744)
+	built := "sha256:" + strings.Repeat("4a2b", 16)
+	fakeExec.Expect("docker", exec.ArgsPrefix("build")).
+		Stderr("#5 [1/2] FROM docker.io/library/ubuntu\n#6 [2/2] RUN make\n#7 writing image " + built + " done\n")
+
+	steps := []int{}
+	img, err := compose.BuildDockerPathWithOptions("app", "/tmp/app", BuildOptions{
+		Progress: func(p BuildProgress) {
+			if p.Step > 0 {
+				steps = append(steps, p.Step)
+			}
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, img, built)
+	assert.Equal(t, steps, []int{1, 2})
+}
+
+func TestFullImageID(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	full := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "0123456789ab")).Stdout(full + "\n")
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "fedcba987654")).Stderr("Error: No such image: fedcba987654\n").ExitCode(1)
+
+	for _, image := range []string{full, strings.TrimPrefix(full, "sha256:"), "0123456789ab"} {
+		id, err := compose.fullImageID(image)
+		assert.Nil(t, err)
+		assert.Equal(t, id, full)
+	}
+	_, err := compose.fullImageID("fedcba987654")
+	assert.Regexp(t, "^failed to resolve docker image id fedcba987654: ", err.Error())
+	fakeExec.AssertExpectations(t)
+}
+
+func TestBuildDockerNoImageID(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.MkdirAll("/tmp/app", 0744)
+	fakeExec.Expect("docker", exec.ArgsPrefix("build")).Stdout("Step 1/1 : FROM ubuntu\n").Stderr("#1 exporting to image\n")
+
+	_, err := compose.BuildDockerPath("app", "/tmp/app")
+	assert.Equal(t, err.Error(), "could not find docker image tag. Full output:\nStep 1/1 : FROM ubuntu\n#1 exporting to image\n")
+	fakeExec.AssertExpectations(t)
+}
@@ -1,11 +1,12 @@
 package dockercompose
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"path"
-	"regexp"
+	"sync"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -25,19 +26,30 @@ const (
 
 type ComposeConfig struct {
 	Version string
+	Offline bool `yaml:"-"`
 }
 
 type Compose struct {
-	id     string
-	tmpDir string
+	id         string
+	tmpDir     string
+	tmpDirOnce sync.Once
+	mutex      sync.Mutex
 
 	ComposeConfig `yaml:",inline"`
 
 	Services map[string]*Service
 	Networks map[string]*Network
+	Extra    map[string]interface{} `yaml:",inline"`
 	status   composeStatus
-	exec     exec.Commander
-	os       os.OS
+
+	pendingServices []string
+	pendingNetworks []string
+
+	exec exec.Commander
+	os   os.OS
+
+	imagesMutex sync.Mutex
+	builtImages []string
 }
 
 func NewCompose(compose ComposeConfig) *Compose {
@@ -58,99 +70,215 @@ func NewCompose(compose ComposeConfig) *Compose {
 }
 
 func (c *Compose) getTmpDir() string {
-	if c.tmpDir == "" {
-		c.tmpDir = path.Join(c.os.TempDir(), "vortices-dockercompose", c.id)
-	}
+	c.tmpDirOnce.Do(func() {
+		if c.tmpDir == "" {
+			c.tmpDir = path.Join(c.os.TempDir(), "vortices-dockercompose", c.id)
+		}
+	})
 	return c.tmpDir
 }
 
 func (c *Compose) AddService(name string, serviceConfig ServiceConfig, networks []ServiceNetworkConfig) *Service {
-	if c.status != composeStatusSetup {
-		panic("cannot register a service after started")
-	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.addService(name, serviceConfig, networks)
+}
+
+func (c *Compose) addService(name string, serviceConfig ServiceConfig, networks []ServiceNetworkConfig) *Service {
 	service := &Service{ServiceConfig: serviceConfig, ContainerName: name, name: name, compose: c}
 	if networks != nil {
-		service.SetNetworks(networks)
+		service.setNetworks(networks)
 	}
 	if _, found := c.Services[name]; found {
 		panic("registering the same service twice")
 	}
 	c.Services[name] = service
+	if c.status == composeStatusRunning {
+		c.pendingServices = append(c.pendingServices, name)
+	}
 	return service
 }
 
 func (c *Compose) AddNetwork(name string, networkConfig NetworkConfig) *Network {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	network := &Network{NetworkConfig: networkConfig, name: name, compose: c}
-	if c.status != composeStatusSetup {
-		panic("cannot register a network after started")
-	}
 	if _, found := c.Networks[name]; found {
 		panic("registering the same network twice")
 	}
 	c.Networks[name] = network
+	if c.status == composeStatusRunning {
+		c.pendingNetworks = append(c.pendingNetworks, name)
+	}
 	return network
 }
 
+func (c *Compose) MarshalYAML() (interface{}, error) {
+	if err := c.checkVersion(); err != nil {
+		return nil, err
+	}
+	services := make(map[string]*Service, len(c.Services))
+	for name, service := range c.Services {
+		if service.Build != nil && service.Build.ContextPath == "" {
+			build := *service.Build
+			build.ContextPath = "./" + serviceBuildDir(name)
+			rendered := *service
+			rendered.Build = &build
+			service = &rendered
+		}
+		services[name] = service
+	}
+	file := yaml.MapSlice{}
+	if c.Version != ComposeSpecification {
+		file = append(file, yaml.MapItem{Key: "version", Value: c.Version})
+	}
+	file = append(file,
+		yaml.MapItem{Key: "services", Value: services},
+		yaml.MapItem{Key: "networks", Value: c.Networks},
+	)
+	for _, key := range sortedExtraKeys(c.Extra) {
+		file = append(file, yaml.MapItem{Key: key, Value: c.Extra[key]})
+	}
+	return file, nil
+}
+
+func (c *Compose) Render(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.render(w)
+}
+
+func (c *Compose) render(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	err := encoder.Encode(c)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
 func (c *Compose) execOrFail(context, name string, arg ...string) ([]byte, error) {
 	cmd := c.exec.New(name, arg...)
 	cmd.SetDir(c.getTmpDir())
-	stdoutPipe, err := cmd.StdoutPipe()
-	stderrPipe, err := cmd.StderrPipe()
-	err = cmd.Start()
-	if err != nil {
-		log.Errorf("failed to start %s: %s", context, err.Error())
-		return nil, fmt.Errorf("failed to start %s: %s", context, err.Error())
-	}
-	stdout, err := ioutil.ReadAll(stdoutPipe)
+	stdout, err := cmd.Output()
 	if err != nil {
-		log.Errorf("failed to read stdout %s: %s", context, err.Error())
-		return nil, fmt.Errorf("failed to read stdout %s: %s", context, err.Error())
-	}
-	stderr, err := ioutil.ReadAll(stderrPipe)
-	if err != nil {
-		log.Errorf("failed to read stderr %s: %s", context, err.Error())
-		return nil, fmt.Errorf("failed to read stderr %s: %s", context, err.Error())
-	}
-	if err = cmd.Wait(); err != nil {
-		log.Errorf("failed to %s: %s\n%s", context, err.Error(), string(stderr))
-		return nil, fmt.Errorf("failed to %s: %s\n%s", context, err.Error(), string(stderr))
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+		log.Errorf("failed to %s: %s\n%s", context, err.Error(), stderr)
+		return nil, fmt.Errorf("failed to %s: %s\n%s", context, err.Error(), stderr)
 	}
 	return stdout, nil
 }
 
 func (c *Compose) Start() error {
-	c.status = composeStatusRunning
-	err := c.os.MkdirAll(c.getTmpDir(), 0744)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.start(nil)
+}
+
+func (c *Compose) StartServices(names ...string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.startServices(names)
+}
+
+func (c *Compose) startServices(names []string) error {
+	order, err := c.dependencyOrder(names)
 	if err != nil {
 		return err
 	}
-	f, err := c.os.Create(path.Join(c.getTmpDir(), "docker-compose.yml"))
+	return c.start(order)
+}
+
+func (c *Compose) writeComposeFile() (bool, error) {
+	err := c.os.MkdirAll(c.getTmpDir(), 0744)
 	if err != nil {
-		return err
+		return false, err
 	}
-	encoder := yaml.NewEncoder(f)
-	err = encoder.Encode(c)
+	build, err := c.writeServiceBuilds()
 	if err != nil {
-		return err
+		return false, err
 	}
-	err = encoder.Close()
+	f, err := c.os.Create(path.Join(c.getTmpDir(), "docker-compose.yml"))
 	if err != nil {
-		return err
+		return false, err
+	}
+	err = c.render(f)
+	if err != nil {
+		f.Close()
+		return false, err
 	}
 	err = f.Close()
 	if err != nil {
-		return err
+		return false, err
+	}
+	return build, c.save()
+}
+
+func (c *Compose) start(services []string) error {
+	if problems := c.validate(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	build := false
+	if c.status != composeStatusRunning {
+		if c.Offline {
+			if err := c.ensureImages(context.Background(), c.images(), nil); err != nil {
+				return err
+			}
+		}
+		var err error
+		build, err = c.writeComposeFile()
+		if err != nil {
+			return err
+		}
+	} else {
+		upServices := services
+		if upServices == nil {
+			upServices = c.serviceNames()
+		}
+		if len(c.pendingServices) > 0 || len(c.pendingNetworks) > 0 {
+			if _, err := c.writeComposeFile(); err != nil {
+				return err
+			}
+		}
+		if err := c.createOrphanNetworks(upServices); err != nil {
+			return err
+		}
+		for _, name := range c.pendingServices {
+			if c.Services[name].Build != nil && containsString(upServices, name) {
+				build = true
+			}
+		}
 	}
 
 	log.Infof("starting docker compose")
 	defer log.Infof("finished starting docker compose")
 
-	_, err = c.execOrFail("start docker compose", "docker-compose", "up", "-d")
+	upArgs := []string{"up", "-d"}
+	if build {
+		upArgs = append(upArgs, "--build")
+	}
+	_, err := c.execOrFail("start docker compose", "docker-compose", append(upArgs, services...)...)
 	if err != nil {
 		return errors.New("failed to start docker-compose")
 	}
 
-	return nil
+	c.status = composeStatusRunning
+	if services == nil {
+		c.pendingServices = nil
+	} else {
+		c.pendingServices = c.waitingServices(services)
+	}
+	pendingNetworks := []string{}
+	for _, name := range c.pendingNetworks {
+		if c.usesNetwork(c.pendingServices, name) {
+			pendingNetworks = append(pendingNetworks, name)
+		}
+	}
+	c.pendingNetworks = pendingNetworks
+	return c.save()
 }
 
 func (c *Compose) Logs(machine ...string) (string, error) {
@@ -163,6 +291,8 @@ func (c *Compose) Logs(machine ...string) (string, error) {
 }
 
 func (c *Compose) Stop() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	if c.status != composeStatusRunning {
 		return errors.New("cannot stop if status is not running")
 	}
@@ -176,10 +306,16 @@ func (c *Compose) Stop() error {
 		return errors.New("failed to stop docker-compose")
 	}
 
-	return nil
+	return c.save()
 }
 
 func (c *Compose) Clear() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.clear()
+}
+
+func (c *Compose) clear() error {
 	if c.status == composeStatusRunning {
 		return errors.New("cannot clear if status is running")
 	}
@@ -187,68 +323,29 @@ func (c *Compose) Clear() error {
 	log.Infof("clearing docker compose")
 	defer log.Infof("finished clearing docker compose")
 
-	if c.tmpDir == "" {
-		return nil
-	}
-
-	return c.os.RemoveAll(c.tmpDir)
+	return c.os.RemoveAll(c.getTmpDir())
 }
 
-func (c *Compose) BuildDockerPath(name, path string) (string, error) {
-	if !c.os.FileExists(path) {
-		return "", fmt.Errorf("path %s does not exist", path)
-	}
-
-	log.Infof("starting to build docker image %s", name)
-	defer log.Infof("finished building docker image %s", name)
-
-	cmd := c.exec.New("docker", "build", path)
-	outPipe, err := cmd.StdoutPipe()
-	errPipe, err := cmd.StderrPipe()
-	err = cmd.Start()
-	if err != nil {
-		return "", fmt.Errorf("failed to build docker image at path %s: %s", path, err.Error())
-	}
-	out, err := ioutil.ReadAll(outPipe)
-	if err != nil {
-		return "", fmt.Errorf("failed to read docker image at path %s: %s", path, err.Error())
-	}
-	stderr, err := ioutil.ReadAll(errPipe)
-	if err != nil {
-		return "", fmt.Errorf("failed to read docker stderr at path %s: %s", path, err.Error())
-	}
-	if err = cmd.Wait(); err != nil {
-		return "", fmt.Errorf("failed to build docker image at path %s: %s\n%s", path, err.Error(), string(stderr))
-	}
-	submatches := regexp.MustCompile(`Successfully built ([a-fA-F0-9]*)`).FindStringSubmatch(string(out))
-	if len(submatches) == 0 {
-		return "", fmt.Errorf("could not find docker image tag. Full output:\n%s", string(out))
+func (c *Compose) Purge() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.status == composeStatusRunning {
+		return errors.New("cannot purge if status is running")
 	}
-	return submatches[1], nil
-}
 
-func (c *Compose) BuildDocker(name, script string) (string, error) {
-	return c.buildDocker(name, script, uuid.New().String())
-}
+	log.Infof("purging docker compose")
+	defer log.Infof("finished purging docker compose")
 
-func (c *Compose) buildDocker(name, script, uuidString string) (string, error) {
-	dirPath := path.Join(c.os.TempDir(), uuidString)
-	err := c.os.MkdirAll(dirPath, 0744)
-	if err != nil {
-		return "", err
+	if c.status == composeStatusStopped {
+		_, err := c.execOrFail("purge docker compose", "docker-compose", "down", "--volumes", "--remove-orphans", "--rmi", "local")
+		if err != nil {
+			return errors.New("failed to purge docker-compose")
+		}
 	}
 
-	filePath := path.Join(dirPath, "Dockerfile")
-	f, err := c.os.Create(filePath)
-	if err != nil {
-		return "", err
-	}
-	_, err = f.Write([]byte(script))
-	if err != nil {
-		return "", err
+	err := c.removeProjectImages()
+	if clearErr := c.clear(); err == nil {
+		err = clearErr
 	}
-	f.Close()
-	defer c.os.RemoveAll(dirPath)
-
-	return c.BuildDockerPath(name, dirPath)
+	return err
 }
@@ -1,9 +1,15 @@
 package dockercompose
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"io"
-	"net"
+	"io/ioutil"
+	goos "os"
 	"path"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/seppo0010/vortices-dockercompose/exec"
@@ -62,13 +68,18 @@ func TestStart(t *testing.T) {
 	assert.Nil(t, err)
 
 	assert.Equal(t, len(ranCommands), 1)
-	assert.Equal(t, len(fakeOS.WrittenFiles), 1)
+	files, err := fakeOS.ReadDir(compose.getTmpDir())
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 2)
+	assert.True(t, fakeOS.FileExists(path.Join(compose.getTmpDir(), "state.json")))
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
 
 	assert.Equal(t, ranCommands[0].Path, "docker-compose")
 	assert.Equal(t, ranCommands[0].Args, []string{"up", "-d"})
-	assert.Equal(t, ranCommands[0].Dir, path.Dir(fakeOS.WrittenFiles[0].Name))
+	assert.Equal(t, ranCommands[0].Dir, compose.getTmpDir())
 
-	assert.Equal(t, string(fakeOS.WrittenFiles[0].Contents.Bytes()),
+	assert.Equal(t, string(contents),
 		`version: "2.1"
 services:
   test-service:
@@ -89,7 +100,7 @@ networks:
 
 func TestStop(t *testing.T) {
 	ranCommands := []*exec.FakeCmd{}
-	compose, fakeExec, fakeOS := mockCompose()
+	compose, fakeExec, _ := mockCompose()
 	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
 		ranCommands = append(ranCommands, cmd)
 		return nil
@@ -106,7 +117,7 @@ func TestStop(t *testing.T) {
 
 	assert.Equal(t, ranCommands[1].Path, "docker-compose")
 	assert.Equal(t, ranCommands[1].Args, []string{"down"})
-	assert.Equal(t, ranCommands[1].Dir, path.Dir(fakeOS.WrittenFiles[0].Name))
+	assert.Equal(t, ranCommands[1].Dir, compose.getTmpDir())
 }
 
 func TestNetworkIntegration(t *testing.T) {
@@ -121,33 +132,82 @@ func TestNetworkIntegration(t *testing.T) {
 	assert.Nil(t, err)
 }
 
-func TestGetIPAddressIntegration(t *testing.T) {
-	compose := NewCompose(ComposeConfig{})
-	network1 := compose.AddNetwork("test-network1", NetworkConfig{})
-	network2 := compose.AddNetwork("test-network2", NetworkConfig{})
+var record = flag.Bool("record", false, "record docker transcripts into testdata")
+
+func getIPAddressTopology(compose *Compose) (*Service, *Network, *Network) {
+	network1 := compose.AddNetwork("test-network1", NetworkConfig{Subnet: "10.231.1.0/24"})
+	network2 := compose.AddNetwork("test-network2", NetworkConfig{Subnet: "10.231.2.0/24"})
 	service := compose.AddService("test-service", ServiceConfig{
 		Image:   "ubuntu",
 		Command: []string{"sleep", "infinity"},
 	}, []ServiceNetworkConfig{
-		ServiceNetworkConfig{Network: network1},
-		ServiceNetworkConfig{Network: network2},
+		ServiceNetworkConfig{Network: network1, IPv4Address: "10.231.1.10"},
+		ServiceNetworkConfig{Network: network2, IPv4Address: "10.231.2.10"},
 	})
+	return service, network1, network2
+}
+
+func TestGetIPAddressIntegration(t *testing.T) {
+	compose := NewCompose(ComposeConfig{})
+	var recorder *exec.RecordingCommander
+	if *record {
+		recorder = exec.NewRecordingCommander()
+		compose.exec = recorder
+	}
+	service, network1, network2 := getIPAddressTopology(compose)
 	err := compose.Start()
 	assert.Nil(t, err)
 
 	ip1, err := service.GetIPAddressForNetwork(network1)
 	assert.Nil(t, err)
+	assert.Equal(t, ip1, "10.231.1.10")
 	ip2, err := service.GetIPAddressForNetwork(network2)
 	assert.Nil(t, err)
+	assert.Equal(t, ip2, "10.231.2.10")
+
+	err = compose.Stop()
+	assert.Nil(t, err)
+
+	if recorder != nil {
+		var transcript bytes.Buffer
+		assert.Nil(t, recorder.Save(&transcript))
+		assert.Nil(t, ioutil.WriteFile("testdata/get_ip_address.json", transcript.Bytes(), 0644))
+	}
+}
+
+func TestGetIPAddressReplay(t *testing.T) {
+	f, err := ioutil.ReadFile("testdata/get_ip_address.json")
+	if goos.IsNotExist(err) {
+		t.Skip("no recorded transcript, run go test -run TestGetIPAddressIntegration -record against docker")
+	}
+	assert.Nil(t, err)
+	transcript, err := exec.LoadTranscript(bytes.NewReader(f))
+	assert.Nil(t, err)
+	replay := exec.NewReplayCommander(transcript)
+
+	compose, _, _ := mockCompose()
+	compose.exec = replay
+	for _, recording := range transcript.Recordings {
+		if recording.Dir != "" {
+			compose.id = path.Base(recording.Dir)
+			compose.tmpDir = recording.Dir
+			break
+		}
+	}
+	service, network1, network2 := getIPAddressTopology(compose)
+	err = compose.Start()
+	assert.Nil(t, err)
 
-	parsedIP1 := net.ParseIP(ip1)
-	assert.NotNil(t, parsedIP1)
-	parsedIP2 := net.ParseIP(ip2)
-	assert.NotNil(t, parsedIP2)
-	assert.NotEqual(t, ip1, ip2)
+	ip1, err := service.GetIPAddressForNetwork(network1)
+	assert.Nil(t, err)
+	assert.Equal(t, ip1, "10.231.1.10")
+	ip2, err := service.GetIPAddressForNetwork(network2)
+	assert.Nil(t, err)
+	assert.Equal(t, ip2, "10.231.2.10")
 
 	err = compose.Stop()
 	assert.Nil(t, err)
+	replay.AssertExpectations(t)
 }
 
 func TestBuildDockerIntegration(t *testing.T) {
@@ -166,7 +226,7 @@ func TestBuildDocker(t *testing.T) {
 		return nil
 	}
 	fakeExec.StdoutHandler = func(cmd *exec.FakeCmd) (io.ReadCloser, error) {
-		if cmd.Path == "docker" && len(cmd.Args) == 2 && cmd.Args[0] == "build" && cmd.Args[1] == "/tmp/buildme" {
+		if cmd.Path == "docker" && len(cmd.Args) == 6 && cmd.Args[0] == "build" && cmd.Args[1] == "--iidfile" && cmd.Args[5] == "/tmp/buildme" {
 			r, w := io.Pipe()
 			go func() {
 				w.Write([]byte("la la la \nSuccessfully built abcdef\n"))
@@ -174,15 +234,20 @@ func TestBuildDocker(t *testing.T) {
 			}()
 			return r, nil
 		}
+		if cmd.Path == "docker" && len(cmd.Args) == 5 && cmd.Args[0] == "image" && cmd.Args[4] == "abcdef" {
+			return ioutil.NopCloser(strings.NewReader("sha256:abcdef" + strings.Repeat("0", 58) + "\n")), nil
+		}
 		panic("unexpected")
 	}
 	img, err := compose.buildDocker("ubuntu copy", "FROM ubuntu\nRUN echo 1 > /a", "buildme")
 
 	assert.Equal(t, ranCommands[0].Path, "docker")
-	assert.Equal(t, ranCommands[0].Args, []string{"build", "/tmp/buildme"})
+	assert.Equal(t, ranCommands[0].Args[0:2], []string{"build", "--iidfile"})
+	assert.Regexp(t, "^/tmp/vortices-dockercompose-.*\\.iid$", ranCommands[0].Args[2])
+	assert.Equal(t, ranCommands[0].Args[3:], []string{"--label", fmt.Sprintf("%s=%s", projectLabel, compose.id), "/tmp/buildme"})
 
 	assert.Nil(t, err)
-	assert.Equal(t, img, "abcdef")
+	assert.Equal(t, img, "sha256:abcdef"+strings.Repeat("0", 58))
 }
 
 func TestLogsIntegration(t *testing.T) {
@@ -202,16 +267,209 @@ func TestLogsIntegration(t *testing.T) {
 
 func TestClear(t *testing.T) {
 	compose, _, fakeOS := mockCompose()
-	compose.AddService("test-service", ServiceConfig{}, nil)
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
+
+	err := compose.Start()
+	assert.Nil(t, err)
+	err = compose.Stop()
+	assert.Nil(t, err)
+
+	assert.True(t, fakeOS.FileExists(compose.getTmpDir()))
+	err = compose.Clear()
+	assert.Nil(t, err)
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	assert.True(t, fakeOS.FileExists(path.Dir(compose.getTmpDir())))
+}
+
+func TestStartMkdirFails(t *testing.T) {
+	compose, _, fakeOS := mockCompose()
+	fakeOS.InjectFault(os.Fault{Op: os.FaultMkdir, Path: compose.getTmpDir(), Err: goos.ErrPermission})
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
+	err := compose.Start()
+	assert.True(t, goos.IsPermission(err))
+	assert.True(t, fakeOS.FileExists(path.Dir(compose.getTmpDir())))
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+}
+
+func TestStartCreateFails(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.InjectFault(os.Fault{Op: os.FaultCreate, Path: path.Join(compose.getTmpDir(), "docker-compose.yml"), Err: goos.ErrPermission})
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
+	err := compose.Start()
+	assert.True(t, goos.IsPermission(err))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestStartNoSpace(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.InjectFault(os.Fault{Op: os.FaultWrite, Path: path.Join(compose.getTmpDir(), "docker-compose.yml"), Err: os.ErrNoSpace, ShortWrite: 10})
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
+	err := compose.Start()
+	assert.NotNil(t, err)
+	fakeExec.AssertExpectations(t)
+}
 
+func TestStartComposeFails(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d")).Stderr("Creating test-service ... error\n")
+	fakeExec.InjectFault(exec.CommandFault{Path: "docker-compose", ExitCode: 1})
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
+	err := compose.Start()
+	assert.Equal(t, err.Error(), "failed to start docker-compose")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestClearRemoveFails(t *testing.T) {
+	compose, _, fakeOS := mockCompose()
+	compose.AddService("test-service", ServiceConfig{Image: "ubuntu"}, nil)
 	err := compose.Start()
 	assert.Nil(t, err)
 	err = compose.Stop()
 	assert.Nil(t, err)
 
-	before := fakeOS.Dirs
+	fakeOS.InjectFault(os.Fault{Op: os.FaultRemove, Err: syscall.EBUSY})
 	err = compose.Clear()
+	assert.Equal(t, err.(*goos.PathError).Err, syscall.EBUSY)
+	assert.True(t, fakeOS.FileExists(compose.getTmpDir()))
+}
+
+func TestBuildDockerWriteFails(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeOS.InjectFault(os.Fault{Op: os.FaultWrite, Path: "/tmp/buildme/Dockerfile", Err: os.ErrNoSpace})
+	fakeExec.Expect("docker", exec.AnyArgs()).Times(0)
+	_, err := compose.buildDocker("ubuntu copy", "FROM ubuntu\nRUN echo 1 > /a", "buildme")
+	assert.Equal(t, err.(*goos.PathError).Err, os.ErrNoSpace)
+	assert.False(t, fakeOS.FileExists("/tmp/buildme"))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPurge(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	built := expectBuild(fakeExec, "0123456789ab")
+	labeled := "sha256:" + strings.Repeat("f", 64)
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down", "--volumes", "--remove-orphans", "--rmi", "local"))
+	fakeExec.Expect("docker", exec.ExactArgs("images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", projectLabel, compose.id))).Stdout(built + "\n" + labeled + "\n")
+	fakeExec.Expect("docker", exec.ExactArgs("rmi", "-f", built, labeled))
+
+	img, err := compose.BuildDocker("peer", "FROM ubuntu")
+	assert.Nil(t, err)
+	compose.AddService("test-service", ServiceConfig{Image: img}, nil)
+	err = compose.Start()
+	assert.Nil(t, err)
+	err = compose.Purge()
+	assert.Equal(t, err.Error(), "cannot purge if status is running")
+	err = compose.Stop()
+	assert.Nil(t, err)
+	err = compose.Purge()
+	assert.Nil(t, err)
+
+	assert.Equal(t, compose.BuiltImages(), []string{})
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPurgeImageAlreadyGone(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	built := expectBuild(fakeExec, "0123456789ab")
+	fakeExec.Expect("docker", exec.ArgsPrefix("images")).Stdout("")
+	fakeExec.Expect("docker", exec.ExactArgs("rmi", "-f", built)).Stderr("Error: No such image: " + built + "\n").ExitCode(1)
+
+	_, err := compose.BuildDocker("peer", "FROM ubuntu")
+	assert.Nil(t, err)
+	assert.Nil(t, fakeOS.MkdirAll(compose.getTmpDir(), 0744))
+	assert.Nil(t, compose.Purge())
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPurgeRemoveFailsStillClears(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.Expect("docker", exec.ArgsPrefix("images")).Stdout("sha256:abc\n")
+	fakeExec.Expect("docker", exec.ExactArgs("rmi", "-f", "sha256:abc")).Stderr("Error: conflict: unable to delete abc\n").ExitCode(1)
+
+	assert.Nil(t, fakeOS.MkdirAll(compose.getTmpDir(), 0744))
+	assert.Equal(t, compose.Purge().Error(), "failed to remove docker images")
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPurgeKeepsCachedImages(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ExactArgs("images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", projectLabel, compose.id))).Stdout("")
+	fakeExec.Expect("docker", exec.ArgsPrefix("images", "-q", "--no-trunc", "--filter")).Stdout("")
+	expectBuild(fakeExec, "0123456789ab")
+	fakeExec.Expect("docker", exec.ArgsPrefix("rmi")).Times(0)
+
+	results, err := compose.BuildAll([]BuildRequest{
+		BuildRequest{Name: "peer", Context: BuildContext{"Dockerfile": BuildContextFile{Contents: []byte("FROM ubuntu")}}},
+	}, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, compose.BuiltImages(), []string{})
+	assert.Nil(t, compose.Purge())
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRenderSharedBuild(t *testing.T) {
+	compose, _, _ := mockCompose()
+	build := &ServiceBuild{Dockerfile: "FROM ubuntu"}
+	compose.AddService("peer1", ServiceConfig{Build: build}, nil)
+	compose.AddService("peer2", ServiceConfig{Build: build}, nil)
+
+	var first, second bytes.Buffer
+	assert.Nil(t, compose.Render(&first))
+	assert.Nil(t, compose.Render(&second))
+	assert.Equal(t, first.String(), second.String())
+	assert.Contains(t, first.String(), "  peer1:\n    privileged: false\n    build:\n      context: ./build/peer1\n")
+	assert.Contains(t, first.String(), "  peer2:\n    privileged: false\n    build:\n      context: ./build/peer2\n")
+	assert.Equal(t, build, &ServiceBuild{Dockerfile: "FROM ubuntu"})
+}
+
+func TestPurgeNotStarted(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ArgsPrefix("images")).Stdout("")
+
+	err := compose.Purge()
 	assert.Nil(t, err)
-	after := fakeOS.Dirs
-	assert.Equal(t, len(before)-1, len(after))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRender(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	network := compose.AddNetwork("test-network", NetworkConfig{})
+	network.Extra = map[string]interface{}{"driver": "bridge"}
+	compose.AddService("zeta", ServiceConfig{
+		Image:   "ubuntu",
+		Command: []string{"sleep", "infinity"},
+	}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, Aliases: []string{"z"}},
+	})
+	compose.AddService("alpha", ServiceConfig{
+		Build: &ServiceBuild{Dockerfile: "FROM ubuntu", Args: map[string]string{"B": "2", "A": "1"}},
+	}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network},
+	})
+	compose.Extra = map[string]interface{}{"volumes": map[string]interface{}{"data": map[string]interface{}{}}}
+
+	var first, second bytes.Buffer
+	assert.Nil(t, compose.Render(&first))
+	assert.Nil(t, compose.Render(&second))
+	assert.Equal(t, first.String(), second.String())
+
+	golden := "testdata/render.golden"
+	if *update {
+		assert.Nil(t, ioutil.WriteFile(golden, first.Bytes(), 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, first.String(), string(expected))
+
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
 }
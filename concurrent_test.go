@@ -0,0 +1,77 @@
+package dockercompose
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+func TestConcurrentUse(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ArgsPrefix("exec")).Stdout("ok\n").AnyTimes()
+	fakeExec.Expect("docker-compose", exec.ArgsPrefix("logs")).Stdout("peer-1 | ready\n").AnyTimes()
+	fakeExec.Expect("docker", exec.ArgsPrefix("inspect", "-f", "{{json .NetworkSettings.Networks}}")).Stdout(`{"lanid":{"IPAddress":"172.18.0.2"}}`).AnyTimes()
+	fakeExec.Expect("docker", exec.ArgsPrefix("inspect", "-f")).Stdout("lan\n").AnyTimes()
+	fakeExec.Expect("docker-compose", exec.ArgsPrefix("up", "-d")).AnyTimes()
+	network := compose.AddNetwork("lan", NetworkConfig{})
+	group := compose.AddServiceGroup("peer", 4, ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network},
+	})
+	assert.Nil(t, compose.Start())
+
+	var wg sync.WaitGroup
+	for i, service := range group.Replicas() {
+		wg.Add(4)
+		go func(service *Service) {
+			defer wg.Done()
+			out, err := service.Exec("hostname").Output()
+			assert.Nil(t, err)
+			assert.Equal(t, string(out), "ok\n")
+		}(service)
+		go func(service *Service) {
+			defer wg.Done()
+			ip, err := service.GetIPAddressForNetwork(network)
+			assert.Nil(t, err)
+			assert.Equal(t, ip, "172.18.0.2")
+		}(service)
+		go func(service *Service) {
+			defer wg.Done()
+			logs, err := compose.Logs(service.name)
+			assert.Nil(t, err)
+			assert.Equal(t, logs, "peer-1 | ready\n")
+		}(service)
+		go func(i int) {
+			defer wg.Done()
+			compose.AddService(fmt.Sprintf("extra-%d", i), ServiceConfig{Image: "ubuntu"}, nil)
+			assert.Nil(t, compose.Update())
+			compose.Validate()
+			compose.Images()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, len(compose.Services), 8)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestConcurrentGetTmpDir(t *testing.T) {
+	compose, _, _ := mockCompose()
+	dirs := make(chan string, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(dirs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dirs <- compose.getTmpDir()
+		}()
+	}
+	wg.Wait()
+	close(dirs)
+	for dir := range dirs {
+		assert.Equal(t, dir, compose.getTmpDir())
+	}
+}
@@ -0,0 +1,152 @@
+package dockercompose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type DependencyCondition string
+
+const (
+	DependencyStarted   DependencyCondition = "service_started"
+	DependencyHealthy   DependencyCondition = "service_healthy"
+	DependencyCompleted DependencyCondition = "service_completed_successfully"
+)
+
+type Dependencies map[string]DependencyCondition
+
+func (d Dependencies) names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d Dependencies) condition(name string) DependencyCondition {
+	if d[name] == "" {
+		return DependencyStarted
+	}
+	return d[name]
+}
+
+func (d Dependencies) longForm() bool {
+	for name := range d {
+		if d.condition(name) != DependencyStarted {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Dependencies) MarshalYAML() (interface{}, error) {
+	if !d.longForm() {
+		return d.names(), nil
+	}
+	dependencies := yaml.MapSlice{}
+	for _, name := range d.names() {
+		dependencies = append(dependencies, yaml.MapItem{
+			Key:   name,
+			Value: map[string]DependencyCondition{"condition": d.condition(name)},
+		})
+	}
+	return dependencies, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compose) dependencyProblems() []ValidationProblem {
+	problems := []ValidationProblem{}
+	for _, name := range c.serviceNames() {
+		dependencies := c.Services[name].DependsOn
+		for _, dependency := range dependencies.names() {
+			if _, found := c.Services[dependency]; !found {
+				problems = append(problems, ValidationProblem{Service: name, Message: fmt.Sprintf("depends on unknown service %s", dependency)})
+			}
+			switch dependencies.condition(dependency) {
+			case DependencyStarted, DependencyHealthy, DependencyCompleted:
+			default:
+				problems = append(problems, ValidationProblem{Service: name, Message: fmt.Sprintf("invalid dependency condition %s", dependencies[dependency])})
+			}
+		}
+	}
+
+	visited := map[string]bool{}
+	for _, name := range c.serviceNames() {
+		if cycle := c.findDependencyCycle(name, visited, []string{}); cycle != nil {
+			problems = append(problems, ValidationProblem{Service: cycle[0], Message: fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> "))})
+			for _, member := range cycle {
+				visited[member] = true
+			}
+		}
+	}
+	return problems
+}
+
+func (c *Compose) findDependencyCycle(name string, visited map[string]bool, stack []string) []string {
+	for i, stacked := range stack {
+		if stacked == name {
+			return append(append([]string{}, stack[i:]...), name)
+		}
+	}
+	service, found := c.Services[name]
+	if visited[name] || !found {
+		return nil
+	}
+	stack = append(stack, name)
+	for _, dependency := range service.DependsOn.names() {
+		if cycle := c.findDependencyCycle(dependency, visited, stack); cycle != nil {
+			return cycle
+		}
+	}
+	visited[name] = true
+	return nil
+}
+
+func (c *Compose) dependencyOrder(names []string) ([]string, error) {
+	order := []string{}
+	done := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		service, found := c.Services[name]
+		if !found {
+			return fmt.Errorf("unknown service %s", name)
+		}
+		if visiting[name] {
+			return fmt.Errorf("dependency cycle through service %s", name)
+		}
+		visiting[name] = true
+		for _, dependency := range service.DependsOn.names() {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+	if len(names) == 0 {
+		names = c.serviceNames()
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
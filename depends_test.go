@@ -0,0 +1,117 @@
+package dockercompose
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+func TestRenderDependsOnShortForm(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("signaling", ServiceConfig{Image: "signaling"}, nil)
+	compose.AddService("peer", ServiceConfig{
+		Image:     "ubuntu",
+		DependsOn: Dependencies{"stun": DependencyStarted, "signaling": ""},
+	}, nil)
+
+	var out bytes.Buffer
+	assert.Nil(t, compose.Render(&out))
+	assert.Contains(t, out.String(), `  peer:
+    image: ubuntu
+    privileged: false
+    depends_on:
+    - signaling
+    - stun
+`)
+}
+
+func TestRenderDependsOnLongForm(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("signaling", ServiceConfig{Image: "signaling"}, nil)
+	compose.AddService("peer", ServiceConfig{
+		Image:     "ubuntu",
+		DependsOn: Dependencies{"stun": DependencyStarted, "signaling": DependencyHealthy},
+	}, nil)
+
+	var out bytes.Buffer
+	assert.Nil(t, compose.Render(&out))
+	assert.Contains(t, out.String(), `    depends_on:
+      signaling:
+        condition: service_healthy
+      stun:
+        condition: service_started
+`)
+
+	compose.Version = "3.8"
+	assert.Equal(t, compose.Render(&out).Error(), "compose file version 3.8 does not support depends_on condition service_healthy in service peer, depends_on condition service_started in service peer")
+
+	compose.Version = "2.4"
+	compose.Services["peer"].DependsOn["stun"] = DependencyCompleted
+	assert.Equal(t, compose.Render(&out).Error(), "compose file version 2.4 does not support depends_on condition service_completed_successfully in service peer")
+
+	compose.Version = ComposeSpecification
+	assert.Nil(t, compose.Render(&out))
+}
+
+func TestValidateDependencies(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.AddService("a", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"b": ""}}, nil)
+	compose.AddService("b", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"c": ""}}, nil)
+	compose.AddService("c", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"a": ""}}, nil)
+	compose.AddService("d", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"missing": "", "a": "service_ready"}}, nil)
+
+	assert.Equal(t, compose.Validate(), []ValidationProblem{
+		ValidationProblem{Service: "d", Message: "invalid dependency condition service_ready"},
+		ValidationProblem{Service: "d", Message: "depends on unknown service missing"},
+		ValidationProblem{Service: "a", Message: "dependency cycle a -> b -> c -> a"},
+	})
+}
+
+func TestStartServices(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "stun", "signaling", "peer1"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "stun", "signaling", "peer2"))
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("signaling", ServiceConfig{Image: "signaling", DependsOn: Dependencies{"stun": ""}}, nil)
+	compose.AddService("peer1", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"signaling": DependencyHealthy, "stun": ""}}, nil)
+	compose.AddService("peer2", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"signaling": DependencyHealthy}}, nil)
+
+	assert.Nil(t, compose.StartServices("peer1"))
+	assert.Nil(t, compose.StartServices("peer2"))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestStartServicesUnknown(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+
+	assert.Equal(t, compose.StartServices("ghost").Error(), "unknown service ghost")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestLoadComposeDependsOn(t *testing.T) {
+	compose, err := LoadCompose(strings.NewReader(`services:
+  stun:
+    image: coturn/coturn
+  signaling:
+    image: signaling
+    depends_on:
+    - stun
+  peer:
+    image: ubuntu
+    depends_on:
+      signaling:
+        condition: service_healthy
+`), "/project")
+	assert.Nil(t, err)
+	assert.Equal(t, compose.Services["signaling"].DependsOn, Dependencies{"stun": DependencyStarted})
+	assert.Equal(t, compose.Services["peer"].DependsOn, Dependencies{"signaling": DependencyHealthy})
+}
@@ -1,6 +1,7 @@
 package exec
 
 import (
+	"fmt"
 	"io"
 	"os"
 )
@@ -9,12 +10,17 @@ type Cmd interface {
 	SetPath(path string)
 	SetArgs(args []string)
 	SetDir(dir string)
+	SetEnv(env []string)
+	SetStdin(stdin io.Reader)
 	StderrPipe() (io.ReadCloser, error)
 	StdinPipe() (io.WriteCloser, error)
 	StdoutPipe() (io.ReadCloser, error)
 	Start() error
 	Wait() error
 	Run() error
+	Output() ([]byte, error)
+	CombinedOutput() ([]byte, error)
+	ExitCode() int
 	Kill() error
 	Signal(sig os.Signal) error
 }
@@ -22,3 +28,20 @@ type Cmd interface {
 type Commander interface {
 	New(name string, arg ...string) Cmd
 }
+
+type ExitError struct {
+	Code   int
+	Signal os.Signal
+	Stderr []byte
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != nil {
+		return fmt.Sprintf("signal: %s", e.Signal)
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
@@ -0,0 +1,240 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+type ArgsMatcher interface {
+	Match(args []string) bool
+	String() string
+}
+
+type anyArgs struct{}
+
+func AnyArgs() ArgsMatcher {
+	return anyArgs{}
+}
+
+func (anyArgs) Match(args []string) bool {
+	return true
+}
+
+func (anyArgs) String() string {
+	return "*"
+}
+
+type exactArgs []string
+
+func ExactArgs(args ...string) ArgsMatcher {
+	return exactArgs(args)
+}
+
+func (e exactArgs) Match(args []string) bool {
+	if len(args) != len(e) {
+		return false
+	}
+	for i := range e {
+		if args[i] != e[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e exactArgs) String() string {
+	return strings.Join(e, " ")
+}
+
+type argsPrefix []string
+
+func ArgsPrefix(prefix ...string) ArgsMatcher {
+	return argsPrefix(prefix)
+}
+
+func (a argsPrefix) Match(args []string) bool {
+	if len(args) < len(a) {
+		return false
+	}
+	return exactArgs(a).Match(args[:len(a)])
+}
+
+func (a argsPrefix) String() string {
+	return strings.Join(append([]string(a), "*"), " ")
+}
+
+type Expectation struct {
+	path     string
+	args     ArgsMatcher
+	stdout   []byte
+	stderr   []byte
+	exitCode int
+	delay    time.Duration
+	dir      *string
+	stdin    *string
+	minCalls int
+	maxCalls int
+	calls    int
+	index    int
+}
+
+func (e *Expectation) Stdout(stdout string) *Expectation {
+	e.stdout = []byte(stdout)
+	return e
+}
+
+func (e *Expectation) Stderr(stderr string) *Expectation {
+	e.stderr = []byte(stderr)
+	return e
+}
+
+func (e *Expectation) ExitCode(code int) *Expectation {
+	e.exitCode = code
+	return e
+}
+
+func (e *Expectation) Dir(dir string) *Expectation {
+	e.dir = &dir
+	return e
+}
+
+func (e *Expectation) Stdin(stdin string) *Expectation {
+	e.stdin = &stdin
+	return e
+}
+
+func (e *Expectation) Delay(delay time.Duration) *Expectation {
+	e.delay = delay
+	return e
+}
+
+func (e *Expectation) Times(n int) *Expectation {
+	e.minCalls = n
+	e.maxCalls = n
+	return e
+}
+
+func (e *Expectation) AnyTimes() *Expectation {
+	e.minCalls = 0
+	e.maxCalls = -1
+	return e
+}
+
+func (e *Expectation) String() string {
+	return fmt.Sprintf("%s %s", e.path, e.args)
+}
+
+func (e *Expectation) matches(path string, args []string, dir string) bool {
+	return e.path == path && e.args.Match(args) && (e.dir == nil || *e.dir == dir)
+}
+
+func (e *Expectation) checkStdin(stdin string) error {
+	if e.stdin != nil && *e.stdin != stdin {
+		return fmt.Errorf("expected %s to receive stdin %q, got %q", e, *e.stdin, stdin)
+	}
+	return nil
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.maxCalls >= 0 && e.calls >= e.maxCalls
+}
+
+func (e *Expectation) run(ctx context.Context) error {
+	select {
+	case <-time.After(e.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if e.exitCode != 0 {
+		return &ExitError{Code: e.exitCode}
+	}
+	return nil
+}
+
+func (f *FakeCommander) Expect(path string, args ArgsMatcher) *Expectation {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if args == nil {
+		args = AnyArgs()
+	}
+	expectation := &Expectation{
+		path:     path,
+		args:     args,
+		minCalls: 1,
+		maxCalls: 1,
+		index:    len(f.expectations),
+	}
+	f.expectations = append(f.expectations, expectation)
+	return expectation
+}
+
+func (f *FakeCommander) InOrder() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.inOrder = true
+}
+
+func (f *FakeCommander) AssertExpectations(t TB) bool {
+	t.Helper()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ok := true
+	for _, problem := range f.problems {
+		t.Errorf("%s", problem)
+		ok = false
+	}
+	for _, expectation := range f.expectations {
+		if expectation.calls < expectation.minCalls {
+			t.Errorf("expected %s to be called %d times, got %d", expectation, expectation.minCalls, expectation.calls)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (f *FakeCommander) hasExpectations() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.expectations) > 0
+}
+
+func (f *FakeCommander) problem(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.problems = append(f.problems, err.Error())
+}
+
+func (f *FakeCommander) match(path string, args []string, dir string) *Expectation {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, expectation := range f.expectations {
+		if !expectation.matches(path, args, dir) || expectation.exhausted() {
+			continue
+		}
+		if f.inOrder {
+			for _, previous := range f.expectations[:expectation.index] {
+				if previous.calls < previous.minCalls {
+					f.problems = append(f.problems, fmt.Sprintf("%s %s called before %s", path, strings.Join(args, " "), previous))
+				}
+			}
+		}
+		expectation.calls++
+		return expectation
+	}
+	f.problems = append(f.problems, unexpectedCommand(path, args, dir).Error())
+	return nil
+}
+
+func unexpectedCommand(path string, args []string, dir string) error {
+	if dir != "" {
+		return fmt.Errorf("unexpected command %s %s in %s", path, strings.Join(args, " "), dir)
+	}
+	return fmt.Errorf("unexpected command %s %s", path, strings.Join(args, " "))
+}
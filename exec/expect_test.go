@@ -0,0 +1,176 @@
+package exec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingTB struct {
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectOutput(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("docker", ExactArgs("inspect", "a")).Stdout("1.2.3.4\n")
+	commander.Expect("docker", ArgsPrefix("inspect")).Stdout("5.6.7.8\n")
+
+	stdout, err := commander.New("docker", "inspect", "a").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "1.2.3.4\n")
+	stdout, err = commander.New("docker", "inspect", "b").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "5.6.7.8\n")
+
+	commander.AssertExpectations(t)
+}
+
+func TestExpectExitCode(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("ls", ExactArgs("/fake")).Stderr("no such file\n").ExitCode(2)
+
+	cmd := commander.New("ls", "/fake")
+	_, err := cmd.Output()
+	exitErr, ok := err.(*ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, exitErr.Code, 2)
+	assert.Equal(t, string(exitErr.Stderr), "no such file\n")
+	assert.Equal(t, cmd.ExitCode(), 2)
+
+	commander.AssertExpectations(t)
+}
+
+func TestExpectPipes(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("echo", AnyArgs()).Stdout("hello\n")
+
+	cmd := commander.New("echo", "hello")
+	stdoutPipe, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	stdout, err := ioutil.ReadAll(stdoutPipe)
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "hello\n")
+	assert.Nil(t, cmd.Wait())
+
+	commander.AssertExpectations(t)
+}
+
+func TestExpectDelay(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("sleep", AnyArgs()).Delay(20 * time.Millisecond)
+
+	start := time.Now()
+	err := commander.New("sleep", "1").Run()
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestExpectTimes(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("true", AnyArgs()).Times(2)
+	commander.Expect("false", AnyArgs()).AnyTimes()
+
+	assert.Nil(t, commander.New("true").Run())
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{"expected true * to be called 2 times, got 1"})
+
+	assert.Nil(t, commander.New("true").Run())
+	assert.True(t, commander.AssertExpectations(t))
+
+	assert.NotNil(t, commander.New("true").Run())
+	tb = &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{"unexpected command true "})
+}
+
+func TestExpectUnmatched(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("docker", ExactArgs("ps"))
+
+	_, err := commander.New("docker", "images").Output()
+	assert.NotNil(t, err)
+
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{
+		"unexpected command docker images",
+		"expected docker ps to be called 1 times, got 0",
+	})
+}
+
+func TestExpectInOrder(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.InOrder()
+	commander.Expect("docker-compose", ExactArgs("up", "-d"))
+	commander.Expect("docker-compose", ExactArgs("down"))
+
+	assert.Nil(t, commander.New("docker-compose", "down").Run())
+	assert.Nil(t, commander.New("docker-compose", "up", "-d").Run())
+
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{"docker-compose down called before docker-compose up -d"})
+}
+
+func TestExpectDirStdin(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("wc", ExactArgs("-c")).Dir("/srv").Stdin("hello").Stdout("5\n").Times(2)
+
+	cmd := commander.New("wc", "-c")
+	cmd.SetDir("/srv")
+	cmd.SetStdin(strings.NewReader("hello"))
+	stdout, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "5\n")
+
+	cmd = commander.New("wc", "-c")
+	cmd.SetDir("/srv")
+	stdin, err := cmd.StdinPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	_, err = stdin.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Nil(t, stdin.Close())
+	assert.Nil(t, cmd.Wait())
+	assert.True(t, commander.AssertExpectations(t))
+
+	cmd = commander.New("wc", "-c")
+	cmd.SetDir("/tmp")
+	assert.NotNil(t, cmd.Run())
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{"unexpected command wc -c in /tmp"})
+}
+
+func TestExpectStdinMismatch(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("wc", ExactArgs("-c")).Stdin("hello")
+
+	cmd := commander.New("wc", "-c")
+	cmd.SetStdin(strings.NewReader("bye"))
+	assert.NotNil(t, cmd.Run())
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{`expected wc -c to receive stdin "hello", got "bye"`})
+}
@@ -1,18 +1,50 @@
 package exec
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
 )
 
 type FakeCmd struct {
-	Args []string
-	Dir  string
-	Path string
+	Args  []string
+	Dir   string
+	Env   []string
+	Path  string
+	Stdin io.Reader
 
 	fakeCommander *FakeCommander
 	pipes         []io.Closer
+	stdinPipe     io.Reader
 	finished      chan error
+	err           error
+	matched       bool
+	expectation   *Expectation
+	faultMatched  bool
+	fault         *CommandFault
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	killed   chan struct{}
+	mutex    sync.Mutex
+	started  bool
+	exited   bool
+	signals  []os.Signal
+	signaled os.Signal
+}
+
+func (f *FakeCmd) Context() context.Context {
+	return f.ctx
+}
+
+func (f *FakeCmd) Signals() []os.Signal {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]os.Signal{}, f.signals...)
 }
 
 func (f *FakeCmd) SetArgs(args []string) {
@@ -27,7 +59,36 @@ func (f *FakeCmd) SetDir(dir string) {
 	f.Dir = dir
 }
 
+func (f *FakeCmd) SetEnv(env []string) {
+	f.Env = env
+}
+
+func (f *FakeCmd) SetStdin(stdin io.Reader) {
+	f.Stdin = stdin
+}
+
+func (f *FakeCmd) expected() (*Expectation, error) {
+	if !f.matched {
+		f.matched = true
+		f.expectation = f.fakeCommander.match(f.Path, f.Args, f.Dir)
+	}
+	if f.expectation == nil {
+		return nil, unexpectedCommand(f.Path, f.Args, f.Dir)
+	}
+	return f.expectation, nil
+}
+
 func (f *FakeCmd) StderrPipe() (io.ReadCloser, error) {
+	if fault := f.injectedFault(); fault != nil && fault.PipeErr != nil {
+		return nil, fault.PipeErr
+	}
+	if f.fakeCommander.hasExpectations() {
+		expectation, err := f.expected()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(expectation.stderr)), nil
+	}
 	pipe, err := f.fakeCommander.StderrHandler(f)
 	if pipe != nil {
 		f.pipes = append(f.pipes, pipe)
@@ -36,6 +97,17 @@ func (f *FakeCmd) StderrPipe() (io.ReadCloser, error) {
 }
 
 func (f *FakeCmd) StdinPipe() (io.WriteCloser, error) {
+	if fault := f.injectedFault(); fault != nil && fault.PipeErr != nil {
+		return nil, fault.PipeErr
+	}
+	if f.fakeCommander.hasExpectations() {
+		if _, err := f.expected(); err != nil {
+			return nil, err
+		}
+		reader, writer := io.Pipe()
+		f.stdinPipe = reader
+		return writer, nil
+	}
 	pipe, err := f.fakeCommander.StdinHandler(f)
 	if pipe != nil {
 		f.pipes = append(f.pipes, pipe)
@@ -44,6 +116,16 @@ func (f *FakeCmd) StdinPipe() (io.WriteCloser, error) {
 }
 
 func (f *FakeCmd) StdoutPipe() (io.ReadCloser, error) {
+	if fault := f.injectedFault(); fault != nil && fault.PipeErr != nil {
+		return nil, fault.PipeErr
+	}
+	if f.fakeCommander.hasExpectations() {
+		expectation, err := f.expected()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(expectation.stdout)), nil
+	}
 	pipe, err := f.fakeCommander.StdoutHandler(f)
 	if pipe != nil {
 		f.pipes = append(f.pipes, pipe)
@@ -52,20 +134,68 @@ func (f *FakeCmd) StdoutPipe() (io.ReadCloser, error) {
 }
 
 func (f *FakeCmd) Start() error {
-	if f.fakeCommander.RunHandler != nil {
-		go func() {
-			f.finished <- f.fakeCommander.RunHandler(f)
-		}()
-	} else {
-		go func() {
-			f.finished <- nil
-		}()
+	if fault := f.injectedFault(); fault != nil && fault.StartErr != nil {
+		return fault.StartErr
+	}
+	run := func() error { return nil }
+	if f.fakeCommander.hasExpectations() {
+		expectation, err := f.expected()
+		if err != nil {
+			return err
+		}
+		run = func() error {
+			if err := f.checkStdin(expectation); err != nil {
+				return err
+			}
+			return expectation.run(f.ctx)
+		}
+	} else if f.fakeCommander.RunHandler != nil {
+		run = func() error { return f.fakeCommander.RunHandler(f) }
 	}
+	run = f.withFault(run)
+	go func() {
+		f.finished <- run()
+	}()
+	f.mutex.Lock()
+	f.started = true
+	f.mutex.Unlock()
 	return nil
 }
 
+func (f *FakeCmd) checkStdin(expectation *Expectation) error {
+	if expectation.stdin == nil {
+		return nil
+	}
+	stdin, err := readPipe(f.Stdin)
+	if f.stdinPipe != nil {
+		stdin, err = readPipe(f.stdinPipe)
+	}
+	if err != nil {
+		return err
+	}
+	err = expectation.checkStdin(string(stdin))
+	if err != nil {
+		f.fakeCommander.problem(err)
+	}
+	return err
+}
+
 func (f *FakeCmd) Wait() error {
-	return <-f.finished
+	var err error
+	select {
+	case err = <-f.finished:
+	case <-f.killed:
+		err = errors.New("killed")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.exited = true
+	if err != nil && f.signaled != nil {
+		err = &ExitError{Code: -1, Signal: f.signaled}
+	}
+	f.err = err
+	f.cancel()
+	return err
 }
 
 func (f *FakeCmd) Run() error {
@@ -79,26 +209,132 @@ func (f *FakeCmd) Run() error {
 	return err
 }
 
+func (f *FakeCmd) Output() ([]byte, error) {
+	stdout, stderr, err := f.output(false)
+	if exitErr, ok := err.(*ExitError); ok && exitErr.Stderr == nil {
+		exitErr.Stderr = stderr
+	}
+	return stdout, err
+}
+
+func (f *FakeCmd) CombinedOutput() ([]byte, error) {
+	stdout, _, err := f.output(true)
+	return stdout, err
+}
+
+func (f *FakeCmd) output(combined bool) ([]byte, []byte, error) {
+	var stdoutPipe, stderrPipe io.ReadCloser
+	var err error
+	expectations := f.fakeCommander.hasExpectations()
+	if expectations || f.fakeCommander.StdoutHandler != nil {
+		if stdoutPipe, err = f.StdoutPipe(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if expectations || f.fakeCommander.StderrHandler != nil {
+		if stderrPipe, err = f.StderrPipe(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = f.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	stderrRead := make(chan []byte)
+	go func() {
+		stderr, _ := readPipe(stderrPipe)
+		stderrRead <- stderr
+	}()
+	stdout, err := readPipe(stdoutPipe)
+	stderr := <-stderrRead
+	if err != nil {
+		f.Wait()
+		return nil, nil, err
+	}
+	err = f.Wait()
+	if combined {
+		stdout = append(stdout, stderr...)
+	}
+	return stdout, stderr, err
+}
+
+func readPipe(pipe io.Reader) ([]byte, error) {
+	if pipe == nil {
+		return nil, nil
+	}
+	return ioutil.ReadAll(pipe)
+}
+
+func (f *FakeCmd) ExitCode() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.exited {
+		return -1
+	}
+	if f.err == nil {
+		return 0
+	}
+	if exitErr, ok := f.err.(*ExitError); ok {
+		return exitErr.Code
+	}
+	return -1
+}
+
 func (f *FakeCmd) Kill() error {
-	return nil
+	return f.Signal(os.Kill)
 }
 
 func (f *FakeCmd) Signal(sig os.Signal) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.started {
+		return errors.New("exec: not started")
+	}
+	if f.exited {
+		return errors.New("os: process already finished")
+	}
+	f.signals = append(f.signals, sig)
+	if f.signaled == nil {
+		f.signaled = sig
+		f.cancel()
+	}
+	if sig == os.Kill && !isClosed(f.killed) {
+		close(f.killed)
+	}
 	return nil
 }
 
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
 type FakeCommander struct {
 	StderrHandler func(*FakeCmd) (io.ReadCloser, error)
 	StdoutHandler func(*FakeCmd) (io.ReadCloser, error)
 	StdinHandler  func(*FakeCmd) (io.WriteCloser, error)
 	RunHandler    func(*FakeCmd) error
+
+	mutex        sync.Mutex
+	expectations []*Expectation
+	inOrder      bool
+	problems     []string
+	faults       []*CommandFault
 }
 
 func (f *FakeCommander) New(name string, arg ...string) Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &FakeCmd{
 		Path:          name,
 		Args:          arg,
 		fakeCommander: f,
-		finished:      make(chan error),
+		finished:      make(chan error, 1),
+		ctx:           ctx,
+		cancel:        cancel,
+		killed:        make(chan struct{}),
 	}
 }
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -125,3 +128,129 @@ func TestFakeCommandStdinPipe(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(stdout), "5\n")
 }
+
+func TestFakeCommandOutput(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		StdoutHandler: func(f *FakeCmd) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(strings.Join(f.Args, " ") + "\n")), nil
+		},
+	}).New("echo", "1", "2")
+	assert.Equal(t, cmd.ExitCode(), -1)
+	stdout, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "1 2\n")
+	assert.Equal(t, cmd.ExitCode(), 0)
+}
+
+func TestFakeCommandOutputExitError(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		StderrHandler: func(f *FakeCmd) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("no such file\n")), nil
+		},
+		RunHandler: func(f *FakeCmd) error {
+			return &ExitError{Code: 2}
+		},
+	}).New("ls", "/fake")
+	_, err := cmd.Output()
+	exitErr, ok := err.(*ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, exitErr.Code, 2)
+	assert.Equal(t, string(exitErr.Stderr), "no such file\n")
+	assert.Equal(t, cmd.ExitCode(), 2)
+}
+
+func TestFakeCommandCombinedOutput(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		StdoutHandler: func(f *FakeCmd) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("out\n")), nil
+		},
+		StderrHandler: func(f *FakeCmd) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("err\n")), nil
+		},
+	}).New("sh")
+	output, err := cmd.CombinedOutput()
+	assert.Nil(t, err)
+	assert.Equal(t, string(output), "out\nerr\n")
+}
+
+func TestFakeCommandSetEnvStdin(t *testing.T) {
+	t.Parallel()
+	var env []string
+	var stdin []byte
+	cmd := (&FakeCommander{
+		RunHandler: func(f *FakeCmd) error {
+			env = f.Env
+			var err error
+			stdin, err = ioutil.ReadAll(f.Stdin)
+			return err
+		},
+	}).New("cat")
+	cmd.SetEnv([]string{"GREETING=hi"})
+	cmd.SetStdin(strings.NewReader("there"))
+	err := cmd.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, env, []string{"GREETING=hi"})
+	assert.Equal(t, string(stdin), "there")
+}
+
+func TestFakeCommandKill(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		RunHandler: func(f *FakeCmd) error {
+			<-make(chan struct{})
+			return nil
+		},
+	}).New("sleep", "infinity")
+	assert.NotNil(t, cmd.Kill())
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, cmd.Kill())
+	err := cmd.Wait()
+	assert.Equal(t, err, &ExitError{Code: -1, Signal: os.Kill})
+	assert.Equal(t, err.Error(), "signal: killed")
+	assert.Equal(t, cmd.ExitCode(), -1)
+	assert.Equal(t, cmd.(*FakeCmd).Signals(), []os.Signal{os.Kill})
+	assert.NotNil(t, cmd.Kill())
+}
+
+func TestFakeCommandSignal(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		RunHandler: func(f *FakeCmd) error {
+			<-f.Context().Done()
+			return f.Context().Err()
+		},
+	}).New("sleep", "infinity")
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, cmd.Signal(syscall.SIGTERM))
+	err := cmd.Wait()
+	assert.Equal(t, err, &ExitError{Code: -1, Signal: syscall.SIGTERM})
+	assert.Equal(t, cmd.(*FakeCmd).Signals(), []os.Signal{syscall.SIGTERM})
+}
+
+func TestFakeCommandSignalHandled(t *testing.T) {
+	t.Parallel()
+	cmd := (&FakeCommander{
+		RunHandler: func(f *FakeCmd) error {
+			<-f.Context().Done()
+			return nil
+		},
+	}).New("server")
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, cmd.Signal(os.Interrupt))
+	assert.Nil(t, cmd.Wait())
+	assert.Equal(t, cmd.ExitCode(), 0)
+}
+
+func TestFakeCommandKillExpectation(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("sleep", AnyArgs()).Delay(time.Hour)
+	cmd := commander.New("sleep", "3600")
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, cmd.Signal(syscall.SIGTERM))
+	err := cmd.Wait()
+	assert.Equal(t, err, &ExitError{Code: -1, Signal: syscall.SIGTERM})
+}
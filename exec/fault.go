@@ -0,0 +1,69 @@
+package exec
+
+import (
+	"time"
+)
+
+type CommandFault struct {
+	Path     string
+	Args     ArgsMatcher
+	StartErr error
+	PipeErr  error
+	ExitCode int
+	Delay    time.Duration
+	Times    int
+}
+
+func (f *FakeCommander) InjectFault(fault CommandFault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if fault.Args == nil {
+		fault.Args = AnyArgs()
+	}
+	f.faults = append(f.faults, &fault)
+}
+
+func (f *FakeCommander) matchFault(path string, args []string) *CommandFault {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, fault := range f.faults {
+		if (fault.Path != "" && fault.Path != path) || !fault.Args.Match(args) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+func (f *FakeCmd) injectedFault() *CommandFault {
+	if !f.faultMatched {
+		f.faultMatched = true
+		f.fault = f.fakeCommander.matchFault(f.Path, f.Args)
+	}
+	return f.fault
+}
+
+func (f *FakeCmd) withFault(run func() error) func() error {
+	fault := f.injectedFault()
+	if fault == nil {
+		return run
+	}
+	return func() error {
+		err := run()
+		select {
+		case <-time.After(fault.Delay):
+		case <-f.ctx.Done():
+			return f.ctx.Err()
+		}
+		if err == nil && fault.ExitCode != 0 {
+			return &ExitError{Code: fault.ExitCode}
+		}
+		return err
+	}
+}
@@ -0,0 +1,39 @@
+package exec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultStartErr(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	expected := errors.New("executable file not found in $PATH")
+	commander.InjectFault(CommandFault{Path: "docker-compose", StartErr: expected, Times: 1})
+	assert.Equal(t, commander.New("docker-compose", "up").Run(), expected)
+	assert.Nil(t, commander.New("docker-compose", "up").Run())
+}
+
+func TestFaultPipeErr(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	expected := errors.New("too many open files")
+	commander.InjectFault(CommandFault{Args: ArgsPrefix("inspect"), PipeErr: expected})
+	_, err := commander.New("docker", "inspect", "a").StdoutPipe()
+	assert.Equal(t, err, expected)
+}
+
+func TestFaultExitCodeAfterOutput(t *testing.T) {
+	t.Parallel()
+	commander := &FakeCommander{}
+	commander.Expect("docker-compose", ExactArgs("up", "-d")).Stdout("Creating a ... done\n").Stderr("ERROR: b failed\n")
+	commander.InjectFault(CommandFault{Path: "docker-compose", ExitCode: 1})
+	cmd := commander.New("docker-compose", "up", "-d")
+	stdout, err := cmd.Output()
+	assert.Equal(t, string(stdout), "Creating a ... done\n")
+	assert.Equal(t, err, &ExitError{Code: 1, Stderr: []byte("ERROR: b failed\n")})
+	assert.Equal(t, cmd.ExitCode(), 1)
+	commander.AssertExpectations(t)
+}
@@ -1,6 +1,7 @@
 package exec
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
@@ -21,6 +22,46 @@ func (r *RealCmd) SetDir(dir string) {
 	r.Cmd.Dir = dir
 }
 
+func (r *RealCmd) SetEnv(env []string) {
+	r.Cmd.Env = env
+}
+
+func (r *RealCmd) SetStdin(stdin io.Reader) {
+	r.Cmd.Stdin = stdin
+}
+
+func (r *RealCmd) Wait() error {
+	return r.exitError(r.Cmd.Wait())
+}
+
+func (r *RealCmd) Run() error {
+	return r.exitError(r.Cmd.Run())
+}
+
+func (r *RealCmd) Output() ([]byte, error) {
+	stdout, err := r.Cmd.Output()
+	return stdout, r.exitError(err)
+}
+
+func (r *RealCmd) CombinedOutput() ([]byte, error) {
+	output, err := r.Cmd.CombinedOutput()
+	return output, r.exitError(err)
+}
+
+func (r *RealCmd) ExitCode() int {
+	if r.ProcessState == nil {
+		return -1
+	}
+	return r.ProcessState.ExitCode()
+}
+
+func (r *RealCmd) exitError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &ExitError{Code: exitErr.ExitCode(), Stderr: exitErr.Stderr}
+	}
+	return err
+}
+
 func (r *RealCmd) Kill() error {
 	return r.Process.Kill()
 }
@@ -2,6 +2,7 @@ package exec
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -71,3 +72,42 @@ func TestRealCommandStdinPipe(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, string(stdout), "5\n")
 }
+
+func TestRealCommandOutput(t *testing.T) {
+	t.Parallel()
+	cmd := (&RealCommander{}).New("echo", "1", "2")
+	stdout, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "1 2\n")
+	assert.Equal(t, cmd.ExitCode(), 0)
+}
+
+func TestRealCommandOutputExitError(t *testing.T) {
+	t.Parallel()
+	cmd := (&RealCommander{}).New("ls", "/fake")
+	assert.Equal(t, cmd.ExitCode(), -1)
+	_, err := cmd.Output()
+	exitErr, ok := err.(*ExitError)
+	assert.True(t, ok)
+	assert.Equal(t, exitErr.Code, 2)
+	assert.Equal(t, string(exitErr.Stderr), "ls: cannot access '/fake': No such file or directory\n")
+	assert.Equal(t, cmd.ExitCode(), 2)
+}
+
+func TestRealCommandCombinedOutput(t *testing.T) {
+	t.Parallel()
+	cmd := (&RealCommander{}).New("sh", "-c", "echo out; echo err >&2")
+	output, err := cmd.CombinedOutput()
+	assert.Nil(t, err)
+	assert.Equal(t, string(output), "out\nerr\n")
+}
+
+func TestRealCommandSetEnvStdin(t *testing.T) {
+	t.Parallel()
+	cmd := (&RealCommander{}).New("sh", "-c", "echo $GREETING; cat")
+	cmd.SetEnv([]string{"GREETING=hi"})
+	cmd.SetStdin(strings.NewReader("there"))
+	stdout, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "hi\nthere")
+}
@@ -0,0 +1,210 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+type Recording struct {
+	Path     string   `json:"path"`
+	Args     []string `json:"args"`
+	Dir      string   `json:"dir,omitempty"`
+	Stdin    string   `json:"stdin,omitempty"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exit_code"`
+}
+
+type Transcript struct {
+	Recordings []Recording `json:"recordings"`
+}
+
+func LoadTranscript(r io.Reader) (Transcript, error) {
+	var transcript Transcript
+	err := json.NewDecoder(r).Decode(&transcript)
+	return transcript, err
+}
+
+type RecordingCommander struct {
+	Commander Commander
+
+	mutex      sync.Mutex
+	recordings []Recording
+}
+
+func NewRecordingCommander() *RecordingCommander {
+	return &RecordingCommander{Commander: &RealCommander{}}
+}
+
+func (r *RecordingCommander) New(name string, arg ...string) Cmd {
+	return &recordingCmd{
+		Cmd:       r.Commander.New(name, arg...),
+		commander: r,
+		recording: Recording{Path: name, Args: arg},
+	}
+}
+
+func (r *RecordingCommander) Transcript() Transcript {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return Transcript{Recordings: append([]Recording{}, r.recordings...)}
+}
+
+func (r *RecordingCommander) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.Transcript())
+}
+
+func (r *RecordingCommander) record(recording Recording) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.recordings = append(r.recordings, recording)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type teeWriteCloser struct {
+	io.Writer
+	io.Closer
+}
+
+type recordingCmd struct {
+	Cmd
+	commander *RecordingCommander
+	recording Recording
+	stdin     bytes.Buffer
+	stdout    bytes.Buffer
+	stderr    bytes.Buffer
+}
+
+func (r *recordingCmd) SetPath(path string) {
+	r.recording.Path = path
+	r.Cmd.SetPath(path)
+}
+
+func (r *recordingCmd) SetArgs(args []string) {
+	r.recording.Args = args
+	r.Cmd.SetArgs(args)
+}
+
+func (r *recordingCmd) SetDir(dir string) {
+	r.recording.Dir = dir
+	r.Cmd.SetDir(dir)
+}
+
+func (r *recordingCmd) SetStdin(stdin io.Reader) {
+	r.Cmd.SetStdin(io.TeeReader(stdin, &r.stdin))
+}
+
+func (r *recordingCmd) StdinPipe() (io.WriteCloser, error) {
+	pipe, err := r.Cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	return teeWriteCloser{io.MultiWriter(pipe, &r.stdin), pipe}, nil
+}
+
+func (r *recordingCmd) StdoutPipe() (io.ReadCloser, error) {
+	pipe, err := r.Cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	return teeReadCloser{io.TeeReader(pipe, &r.stdout), pipe}, nil
+}
+
+func (r *recordingCmd) StderrPipe() (io.ReadCloser, error) {
+	pipe, err := r.Cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	return teeReadCloser{io.TeeReader(pipe, &r.stderr), pipe}, nil
+}
+
+func (r *recordingCmd) Wait() error {
+	err := r.Cmd.Wait()
+	r.finish()
+	return err
+}
+
+func (r *recordingCmd) Run() error {
+	err := r.Cmd.Run()
+	r.finish()
+	return err
+}
+
+func (r *recordingCmd) Output() ([]byte, error) {
+	stdoutPipe, err := r.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrPipe, err := r.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Cmd.Start(); err != nil {
+		return nil, err
+	}
+	stderrRead := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(stderrPipe)
+		close(stderrRead)
+	}()
+	stdout, err := ioutil.ReadAll(stdoutPipe)
+	<-stderrRead
+	if err != nil {
+		r.Wait()
+		return nil, err
+	}
+	err = r.Wait()
+	if exitErr, ok := err.(*ExitError); ok && exitErr.Stderr == nil {
+		exitErr.Stderr = r.stderr.Bytes()
+	}
+	return stdout, err
+}
+
+func (r *recordingCmd) CombinedOutput() ([]byte, error) {
+	output, err := r.Cmd.CombinedOutput()
+	r.stdout.Write(output)
+	r.finish()
+	return output, err
+}
+
+func (r *recordingCmd) finish() {
+	recording := r.recording
+	recording.Stdin = r.stdin.String()
+	recording.Stdout = r.stdout.String()
+	recording.Stderr = r.stderr.String()
+	recording.ExitCode = r.Cmd.ExitCode()
+	r.commander.record(recording)
+}
+
+type ReplayCommander struct {
+	FakeCommander
+}
+
+func NewReplayCommander(transcript Transcript) *ReplayCommander {
+	replay := &ReplayCommander{}
+	last := map[string]*Expectation{}
+	for _, recording := range transcript.Recordings {
+		expectation := replay.Expect(recording.Path, ExactArgs(recording.Args...)).
+			Stdout(recording.Stdout).
+			Stderr(recording.Stderr).
+			ExitCode(recording.ExitCode).
+			Dir(recording.Dir).
+			Stdin(recording.Stdin)
+		expectation.minCalls = 0
+		last[fmt.Sprintf("%q", append([]string{recording.Path}, recording.Args...))] = expectation
+	}
+	for _, expectation := range last {
+		expectation.maxCalls = -1
+	}
+	return replay
+}
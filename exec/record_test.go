@@ -0,0 +1,105 @@
+package exec
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordingCommander(t *testing.T) {
+	t.Parallel()
+	commander := NewRecordingCommander()
+
+	cmd := commander.New("echo", "1", "2")
+	cmd.SetDir("/")
+	stdout, err := cmd.Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "1 2\n")
+
+	_, err = commander.New("sh", "-c", "echo out; echo err >&2; exit 3").Output()
+	assert.NotNil(t, err)
+
+	cmd = commander.New("wc", "-c")
+	cmd.SetStdin(strings.NewReader("hello"))
+	stdoutPipe, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	_, err = ioutil.ReadAll(stdoutPipe)
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Wait())
+
+	assert.Equal(t, commander.Transcript(), Transcript{Recordings: []Recording{
+		Recording{Path: "echo", Args: []string{"1", "2"}, Dir: "/", Stdout: "1 2\n"},
+		Recording{Path: "sh", Args: []string{"-c", "echo out; echo err >&2; exit 3"}, Stdout: "out\n", Stderr: "err\n", ExitCode: 3},
+		Recording{Path: "wc", Args: []string{"-c"}, Stdin: "hello", Stdout: "5\n"},
+	}})
+}
+
+func TestRecordingCommanderSaveLoad(t *testing.T) {
+	t.Parallel()
+	commander := NewRecordingCommander()
+	_, err := commander.New("echo", "1").Output()
+	assert.Nil(t, err)
+
+	buffer := &bytes.Buffer{}
+	err = commander.Save(buffer)
+	assert.Nil(t, err)
+	transcript, err := LoadTranscript(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, transcript, commander.Transcript())
+}
+
+func TestReplayCommander(t *testing.T) {
+	t.Parallel()
+	commander := NewReplayCommander(Transcript{Recordings: []Recording{
+		Recording{Path: "docker", Args: []string{"ps"}, Stdout: "first\n"},
+		Recording{Path: "docker", Args: []string{"ps"}, Stdout: "second\n"},
+		Recording{Path: "docker", Args: []string{"rm", "a"}, Stderr: "no such container\n", ExitCode: 1},
+	}})
+
+	stdout, err := commander.New("docker", "ps").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "first\n")
+	stdout, err = commander.New("docker", "ps").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "second\n")
+	stdout, err = commander.New("docker", "ps").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(stdout), "second\n")
+
+	cmd := commander.New("docker", "rm", "a")
+	_, err = cmd.Output()
+	assert.Equal(t, err, &ExitError{Code: 1, Stderr: []byte("no such container\n")})
+	assert.Equal(t, cmd.ExitCode(), 1)
+
+	commander.AssertExpectations(t)
+}
+
+func TestReplayCommanderDirStdin(t *testing.T) {
+	t.Parallel()
+	commander := NewReplayCommander(Transcript{Recordings: []Recording{
+		Recording{Path: "wc", Args: []string{"-c"}, Dir: "/srv", Stdin: "hello", Stdout: "5\n"},
+	}})
+
+	cmd := commander.New("wc", "-c")
+	cmd.SetDir("/tmp")
+	cmd.SetStdin(strings.NewReader("hello"))
+	_, err := cmd.Output()
+	assert.NotNil(t, err)
+
+	cmd = commander.New("wc", "-c")
+	cmd.SetDir("/srv")
+	cmd.SetStdin(strings.NewReader("bye"))
+	_, err = cmd.Output()
+	assert.NotNil(t, err)
+
+	tb := &recordingTB{}
+	assert.False(t, commander.AssertExpectations(tb))
+	assert.Equal(t, tb.errors, []string{
+		"unexpected command wc -c in /tmp",
+		`expected wc -c to receive stdin "hello", got "bye"`,
+	})
+}
@@ -0,0 +1,79 @@
+package dockercompose
+
+import (
+	"fmt"
+)
+
+type ServiceGroup struct {
+	name     string
+	services []*Service
+}
+
+func (c *Compose) AddServiceGroup(name string, replicas int, serviceConfig ServiceConfig, networks []ServiceNetworkConfig) *ServiceGroup {
+	if replicas < 1 {
+		panic("a service group needs at least one replica")
+	}
+	for _, network := range networks {
+		if network.Network == nil {
+			panic(fmt.Sprintf("service group %s has a network config without a network", name))
+		}
+		if network.IPv4Address != "" {
+			panic(fmt.Sprintf("cannot assign static ipv4 address %s to every replica of service group %s", network.IPv4Address, name))
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := 1; i <= replicas; i++ {
+		if _, found := c.Services[fmt.Sprintf("%s-%d", name, i)]; found {
+			panic("registering the same service twice")
+		}
+	}
+	group := &ServiceGroup{name: name, services: make([]*Service, 0, replicas)}
+	for i := 1; i <= replicas; i++ {
+		var replicaNetworks []ServiceNetworkConfig
+		if networks != nil {
+			replicaNetworks = make([]ServiceNetworkConfig, 0, len(networks))
+			for _, network := range networks {
+				network.Aliases = append(append([]string{}, network.Aliases...), name)
+				replicaNetworks = append(replicaNetworks, network)
+			}
+		}
+		replicaConfig := serviceConfig
+		replicaConfig.Command = append([]string(nil), serviceConfig.Command...)
+		if serviceConfig.Build != nil {
+			build := *serviceConfig.Build
+			replicaConfig.Build = &build
+		}
+		if serviceConfig.DependsOn != nil {
+			replicaConfig.DependsOn = make(Dependencies, len(serviceConfig.DependsOn))
+			for dependency, condition := range serviceConfig.DependsOn {
+				replicaConfig.DependsOn[dependency] = condition
+			}
+		}
+		group.services = append(group.services, c.addService(fmt.Sprintf("%s-%d", name, i), replicaConfig, replicaNetworks))
+	}
+	return group
+}
+
+func (g *ServiceGroup) Name() string {
+	return g.name
+}
+
+func (g *ServiceGroup) Replicas() []*Service {
+	return append([]*Service{}, g.services...)
+}
+
+func (g *ServiceGroup) Replica(i int) *Service {
+	if i < 1 || i > len(g.services) {
+		return nil
+	}
+	return g.services[i-1]
+}
+
+func (g *ServiceGroup) Names() []string {
+	names := make([]string, 0, len(g.services))
+	for _, service := range g.services {
+		names = append(names, service.name)
+	}
+	return names
+}
@@ -0,0 +1,87 @@
+package dockercompose
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+func TestAddServiceGroup(t *testing.T) {
+	compose, _, _ := mockCompose()
+	network := compose.AddNetwork("lan", NetworkConfig{})
+	group := compose.AddServiceGroup("peer", 3, ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, Aliases: []string{"client"}},
+	})
+
+	assert.Equal(t, group.Name(), "peer")
+	assert.Equal(t, group.Names(), []string{"peer-1", "peer-2", "peer-3"})
+	assert.Equal(t, len(group.Replicas()), 3)
+	assert.Equal(t, group.Replica(2), compose.Services["peer-2"])
+	assert.Nil(t, group.Replica(0))
+	assert.Nil(t, group.Replica(4))
+	assert.Equal(t, compose.Services["peer-1"].Networks["lan"].Aliases, []string{"client", "peer"})
+	assert.Equal(t, compose.Validate(), []ValidationProblem{})
+
+	var out bytes.Buffer
+	assert.Nil(t, compose.Render(&out))
+	assert.Contains(t, out.String(), `  peer-3:
+    image: ubuntu
+    privileged: false
+    container_name: peer-3
+    networks:
+      lan:
+        aliases:
+        - client
+        - peer
+`)
+}
+
+func TestServiceGroupReplicaExec(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("exec", "-T", "peer-2", "hostname")).Stdout("peer-2\n")
+	group := compose.AddServiceGroup("peer", 2, ServiceConfig{Image: "ubuntu"}, nil)
+
+	out, err := group.Replica(2).Exec("hostname").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "peer-2\n")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestServiceGroupReplicasBuildSeparately(t *testing.T) {
+	compose, _, _ := mockCompose()
+	group := compose.AddServiceGroup("peer", 2, ServiceConfig{Build: &ServiceBuild{Dockerfile: "FROM ubuntu"}}, nil)
+
+	var out bytes.Buffer
+	assert.Nil(t, compose.Render(&out))
+	assert.True(t, group.Replica(1).Build != group.Replica(2).Build)
+	assert.Contains(t, out.String(), "context: ./build/peer-1\n")
+	assert.Contains(t, out.String(), "context: ./build/peer-2\n")
+}
+
+func TestAddServiceGroupStaticAddress(t *testing.T) {
+	compose, _, _ := mockCompose()
+	network := compose.AddNetwork("lan", NetworkConfig{Subnet: "10.0.0.0/24"})
+	assert.PanicsWithValue(t, "cannot assign static ipv4 address 10.0.0.2 to every replica of service group peer", func() {
+		compose.AddServiceGroup("peer", 2, ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+			ServiceNetworkConfig{Network: network, IPv4Address: "10.0.0.2"},
+		})
+	})
+	assert.Equal(t, len(compose.Services), 0)
+}
+
+func TestAddServiceGroupNameCollision(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.AddService("peer-2", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.PanicsWithValue(t, "registering the same service twice", func() {
+		compose.AddServiceGroup("peer", 3, ServiceConfig{Image: "ubuntu"}, nil)
+	})
+	assert.Equal(t, compose.serviceNames(), []string{"peer-2"})
+
+	assert.PanicsWithValue(t, "service group peer has a network config without a network", func() {
+		compose.AddServiceGroup("peer", 1, ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{ServiceNetworkConfig{}})
+	})
+	assert.Equal(t, compose.serviceNames(), []string{"peer-2"})
+}
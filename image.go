@@ -0,0 +1,241 @@
+package dockercompose
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+type PullProgress struct {
+	Image string
+	Line  string
+	Done  bool
+}
+
+func streamLines(r io.Reader, fn func(line string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			fn(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			io.Copy(ioutil.Discard, r)
+			return err
+		}
+	}
+}
+
+func (c *Compose) Images() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.images()
+}
+
+var imageIDRegexp = regexp.MustCompile(`^(sha256:[a-f0-9]{12,64}|[a-f0-9]{64})$`)
+
+func (c *Compose) images() []string {
+	seen := map[string]bool{}
+	for _, image := range c.BuiltImages() {
+		seen[image] = true
+	}
+	images := []string{}
+	for _, service := range c.Services {
+		if service.Image == "" || service.Build != nil || seen[service.Image] || imageIDRegexp.MatchString(service.Image) {
+			continue
+		}
+		seen[service.Image] = true
+		images = append(images, service.Image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+func (c *Compose) ImageExists(image string) (bool, error) {
+	_, err := c.exec.New("docker", "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err == nil {
+		return true, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.Code == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to inspect docker image %s: %s", image, err.Error())
+}
+
+func (c *Compose) Pull(ctx context.Context, progress func(PullProgress)) error {
+	return c.pullImages(ctx, c.Images(), progress)
+}
+
+func (c *Compose) pullImages(ctx context.Context, images []string, progress func(PullProgress)) error {
+	if progress == nil {
+		progress = func(PullProgress) {}
+	}
+	for _, image := range images {
+		if err := c.pullImage(ctx, image, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compose) pullImage(ctx context.Context, image string, progress func(PullProgress)) error {
+	log.Infof("pulling docker image %s", image)
+	defer log.Infof("finished pulling docker image %s", image)
+
+	cmd := c.exec.New("docker", "pull", image)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to pipe docker pull %s stdout: %s", image, err.Error())
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to pipe docker pull %s stderr: %s", image, err.Error())
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start docker pull %s: %s", image, err.Error())
+	}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Kill()
+		case <-finished:
+		}
+	}()
+
+	stderrRead := make(chan []byte)
+	go func() {
+		stderr, _ := ioutil.ReadAll(stderrPipe)
+		stderrRead <- stderr
+	}()
+	streamLines(stdoutPipe, func(line string) {
+		progress(PullProgress{Image: image, Line: line})
+	})
+	stderr := <-stderrRead
+	if err = cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to pull docker image %s: %s\n%s", image, err.Error(), string(stderr))
+	}
+	progress(PullProgress{Image: image, Done: true})
+	return nil
+}
+
+func (c *Compose) MissingImages() ([]string, error) {
+	return c.missingImages(c.Images())
+}
+
+func (c *Compose) missingImages(images []string) ([]string, error) {
+	missing := []string{}
+	for _, image := range images {
+		exists, err := c.ImageExists(image)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, image)
+		}
+	}
+	return missing, nil
+}
+
+func (c *Compose) EnsureImages(ctx context.Context, progress func(PullProgress)) error {
+	return c.ensureImages(ctx, c.Images(), progress)
+}
+
+func (c *Compose) ensureImages(ctx context.Context, images []string, progress func(PullProgress)) error {
+	missing, err := c.missingImages(images)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if c.Offline {
+		return fmt.Errorf("missing docker images in offline mode: %s", strings.Join(missing, ", "))
+	}
+	return c.pullImages(ctx, missing, progress)
+}
+
+func sameImageID(a, b string) bool {
+	if !imageIDRegexp.MatchString(a) || !imageIDRegexp.MatchString(b) {
+		return a == b
+	}
+	a = strings.TrimPrefix(a, "sha256:")
+	b = strings.TrimPrefix(b, "sha256:")
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func uniqueImages(images []string) []string {
+	unique := []string{}
+	for _, image := range images {
+		duplicate := false
+		for i, kept := range unique {
+			if sameImageID(image, kept) {
+				if len(image) > len(kept) {
+					unique[i] = image
+				}
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, image)
+		}
+	}
+	return unique
+}
+
+func (c *Compose) removeProjectImages() error {
+	labeledImages, err := c.listImagesByLabel(projectLabel, c.id)
+	if err != nil {
+		return err
+	}
+	images := uniqueImages(append(c.BuiltImages(), labeledImages...))
+	if len(images) == 0 {
+		return nil
+	}
+
+	cmd := c.exec.New("docker", append([]string{"rmi", "-f"}, images...)...)
+	cmd.SetDir(c.getTmpDir())
+	if _, err = cmd.Output(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || !onlyMissingImages(string(exitErr.Stderr)) {
+			stderr := ""
+			if ok {
+				stderr = string(exitErr.Stderr)
+			}
+			log.Errorf("failed to remove docker images: %s\n%s", err.Error(), stderr)
+			return errors.New("failed to remove docker images")
+		}
+	}
+	c.imagesMutex.Lock()
+	c.builtImages = nil
+	c.imagesMutex.Unlock()
+	return nil
+}
+
+func onlyMissingImages(stderr string) bool {
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, "No such image") {
+			return false
+		}
+	}
+	return true
+}
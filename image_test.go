@@ -0,0 +1,121 @@
+package dockercompose
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImages(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.AddService("peer1", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("peer2", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("built", ServiceConfig{Image: "built", Build: &ServiceBuild{Dockerfile: "FROM ubuntu"}}, nil)
+	assert.Equal(t, compose.Images(), []string{"coturn/coturn", "ubuntu"})
+}
+
+func TestImageExists(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "ubuntu")).Stdout("sha256:abc\n")
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "missing")).Stderr("Error: No such image: missing\n").ExitCode(1)
+
+	exists, err := compose.ImageExists("ubuntu")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = compose.ImageExists("missing")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPull(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "coturn/coturn")).Stdout("latest: Pulling from coturn/coturn\nStatus: Image is up to date for coturn/coturn:latest\n")
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "ubuntu")).Stdout("latest: Pulling from library/ubuntu\n")
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+
+	progress := []PullProgress{}
+	err := compose.Pull(context.Background(), func(p PullProgress) {
+		progress = append(progress, p)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, progress, []PullProgress{
+		PullProgress{Image: "coturn/coturn", Line: "latest: Pulling from coturn/coturn"},
+		PullProgress{Image: "coturn/coturn", Line: "Status: Image is up to date for coturn/coturn:latest"},
+		PullProgress{Image: "coturn/coturn", Done: true},
+		PullProgress{Image: "ubuntu", Line: "latest: Pulling from library/ubuntu"},
+		PullProgress{Image: "ubuntu", Done: true},
+	})
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPullCanceled(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "ubuntu")).Delay(time.Hour)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := compose.Pull(ctx, nil)
+	assert.Equal(t, err, context.DeadlineExceeded)
+}
+
+func TestEnsureImagesPullsMissing(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "coturn/coturn")).Stdout("sha256:abc\n")
+	fakeExec.Expect("docker", exec.ExactArgs("image", "inspect", "--format", "{{.Id}}", "ubuntu")).ExitCode(1)
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "ubuntu"))
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+
+	err := compose.EnsureImages(context.Background(), nil)
+	assert.Nil(t, err)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestStartOffline(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	compose.Offline = true
+	fakeExec.Expect("docker", exec.ArgsPrefix("image", "inspect")).ExitCode(1).Times(2)
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+
+	err := compose.Start()
+	assert.Equal(t, err.Error(), "missing docker images in offline mode: coturn/coturn, ubuntu")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestPullSkipsBuiltImages(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	expectBuild(fakeExec, "0123456789ab")
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "deadbeefcafe"))
+	fakeExec.Expect("docker", exec.ExactArgs("pull", "ubuntu"))
+	img, err := compose.BuildDocker("peer", "FROM ubuntu")
+	assert.Nil(t, err)
+	compose.AddService("peer", ServiceConfig{Image: img}, nil)
+	compose.AddService("other", ServiceConfig{Image: "sha256:" + strings.Repeat("f", 64)}, nil)
+	compose.AddService("stun", ServiceConfig{Image: "ubuntu"}, nil)
+	compose.AddService("hex", ServiceConfig{Image: "deadbeefcafe"}, nil)
+
+	assert.Equal(t, compose.Images(), []string{"deadbeefcafe", "ubuntu"})
+	assert.Nil(t, compose.Pull(context.Background(), nil))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestStreamLinesLongLine(t *testing.T) {
+	long := strings.Repeat("#", 1024*1024)
+	lines := []string{}
+	err := streamLines(strings.NewReader("first\r\n"+long+"\nlast"), func(line string) {
+		lines = append(lines, line)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, lines, []string{"first", long, "last"})
+}
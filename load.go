@@ -0,0 +1,466 @@
+package dockercompose
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type composeFile struct {
+	Version  string                            `yaml:"version"`
+	Services map[string]serviceFile            `yaml:"services"`
+	Networks map[string]map[string]interface{} `yaml:"networks"`
+	Extra    map[string]interface{}            `yaml:",inline"`
+}
+
+type serviceFile struct {
+	Image         string                 `yaml:"image"`
+	Command       interface{}            `yaml:"command"`
+	Privileged    bool                   `yaml:"privileged"`
+	Build         interface{}            `yaml:"build"`
+	DependsOn     interface{}            `yaml:"depends_on"`
+	ContainerName string                 `yaml:"container_name"`
+	Networks      interface{}            `yaml:"networks"`
+	Extra         map[string]interface{} `yaml:",inline"`
+}
+
+type buildFile struct {
+	Context    string                 `yaml:"context"`
+	Dockerfile string                 `yaml:"dockerfile"`
+	Args       interface{}            `yaml:"args"`
+	Target     string                 `yaml:"target"`
+	Extra      map[string]interface{} `yaml:",inline"`
+}
+
+func LoadCompose(r io.Reader, baseDir string) (*Compose, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	baseDir, err = filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	compose := NewCompose(ComposeConfig{})
+	if err = compose.load(data, baseDir); err != nil {
+		return nil, err
+	}
+	return compose, nil
+}
+
+func LoadComposeFile(filePath string) (*Compose, error) {
+	compose := NewCompose(ComposeConfig{})
+	data, err := compose.os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	baseDir, err := filepath.Abs(path.Dir(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if err = compose.load(data, baseDir); err != nil {
+		return nil, err
+	}
+	return compose, nil
+}
+
+func (c *Compose) load(data []byte, baseDir string) error {
+	var file composeFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse compose file: %s", err.Error())
+	}
+	c.Version = file.Version
+	if c.Version == "" {
+		c.Version = ComposeSpecification
+	}
+	c.Extra = file.Extra
+	for _, key := range []string{"secrets", "configs"} {
+		if entries, ok := c.Extra[key].(map[interface{}]interface{}); ok {
+			for _, entry := range entries {
+				rebaseMapKey(entry, "file", baseDir)
+			}
+		}
+	}
+
+	for name, extra := range file.Networks {
+		network := c.AddNetwork(name, NetworkConfig{})
+		subnets, err := parseSubnets(extra["ipam"])
+		if err != nil {
+			network.ipamProblem = err.Error()
+		} else if isSingleSubnet(extra["ipam"]) {
+			network.Subnet = subnets[0]
+			delete(extra, "ipam")
+		} else {
+			network.ipamSubnets = subnets
+		}
+		network.Extra = extra
+	}
+
+	serviceNames := make([]string, 0, len(file.Services))
+	for name := range file.Services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		if err := c.loadService(name, file.Services[name], baseDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSubnets(ipam interface{}) ([]string, error) {
+	if ipam == nil {
+		return nil, nil
+	}
+	ipamMap, ok := ipam.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported ipam %v", ipam)
+	}
+	if ipamMap["config"] == nil {
+		return nil, nil
+	}
+	configs, ok := ipamMap["config"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unsupported ipam config %v", ipamMap["config"])
+	}
+	subnets := []string{}
+	for _, entry := range configs {
+		config, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unsupported ipam config entry %v", entry)
+		}
+		subnet, ok := config["subnet"].(string)
+		if !ok {
+			return nil, fmt.Errorf("ipam config entry %v has no subnet", entry)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+func isSingleSubnet(ipam interface{}) bool {
+	ipamMap, ok := ipam.(map[interface{}]interface{})
+	if !ok || len(ipamMap) != 1 {
+		return false
+	}
+	configs, ok := ipamMap["config"].([]interface{})
+	if !ok || len(configs) != 1 {
+		return false
+	}
+	config, ok := configs[0].(map[interface{}]interface{})
+	return ok && len(config) == 1
+}
+
+func (c *Compose) loadService(name string, file serviceFile, baseDir string) error {
+	command, err := parseCommand(file.Command)
+	if err != nil {
+		return fmt.Errorf("invalid command for service %s: %s", name, err.Error())
+	}
+	build, err := parseBuild(file.Build, baseDir)
+	if err != nil {
+		return fmt.Errorf("invalid build for service %s: %s", name, err.Error())
+	}
+	dependsOn, err := parseDependsOn(file.DependsOn)
+	if err != nil {
+		return fmt.Errorf("invalid depends_on for service %s: %s", name, err.Error())
+	}
+	networks, err := c.parseServiceNetworks(file.Networks)
+	if err != nil {
+		return fmt.Errorf("invalid networks for service %s: %s", name, err.Error())
+	}
+
+	service := c.AddService(name, ServiceConfig{
+		Image:      file.Image,
+		Command:    command,
+		Privileged: file.Privileged,
+		Build:      build,
+		DependsOn:  dependsOn,
+	}, networks)
+	if file.ContainerName != "" {
+		service.ContainerName = file.ContainerName
+	}
+	service.Extra = file.Extra
+	rebaseServicePaths(service.Extra, baseDir)
+	return nil
+}
+
+func rebasePath(hostPath, baseDir string) string {
+	if hostPath == "." || hostPath == ".." || strings.HasPrefix(hostPath, "./") || strings.HasPrefix(hostPath, "../") {
+		return path.Join(baseDir, hostPath)
+	}
+	return hostPath
+}
+
+func rebaseMapKey(value interface{}, key, baseDir string) {
+	if values, ok := value.(map[interface{}]interface{}); ok {
+		if hostPath, ok := values[key].(string); ok {
+			values[key] = rebasePath(hostPath, baseDir)
+		}
+	}
+}
+
+func rebaseServicePaths(extra map[string]interface{}, baseDir string) {
+	if volumes, ok := extra["volumes"].([]interface{}); ok {
+		for i, volume := range volumes {
+			if spec, ok := volume.(string); ok {
+				parts := strings.SplitN(spec, ":", 2)
+				parts[0] = rebasePath(parts[0], baseDir)
+				volumes[i] = strings.Join(parts, ":")
+			} else {
+				rebaseMapKey(volume, "source", baseDir)
+			}
+		}
+	}
+	switch envFile := extra["env_file"].(type) {
+	case string:
+		extra["env_file"] = rebasePath(envFile, baseDir)
+	case []interface{}:
+		for i, file := range envFile {
+			if hostPath, ok := file.(string); ok {
+				envFile[i] = rebasePath(hostPath, baseDir)
+			} else {
+				rebaseMapKey(file, "path", baseDir)
+			}
+		}
+	}
+	rebaseMapKey(extra["extends"], "file", baseDir)
+}
+
+func parseDependsOn(dependsOn interface{}) (Dependencies, error) {
+	switch dependsOn := dependsOn.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		names, err := toStrings(dependsOn)
+		if err != nil {
+			return nil, err
+		}
+		dependencies := make(Dependencies, len(names))
+		for _, name := range names {
+			dependencies[name] = DependencyStarted
+		}
+		return dependencies, nil
+	case map[interface{}]interface{}:
+		dependencies := make(Dependencies, len(dependsOn))
+		for name, value := range dependsOn {
+			var dependency struct {
+				Condition DependencyCondition `yaml:"condition"`
+			}
+			data, err := yaml.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if err = yaml.Unmarshal(data, &dependency); err != nil {
+				return nil, err
+			}
+			dependencies[fmt.Sprint(name)] = dependency.Condition
+		}
+		return dependencies, nil
+	}
+	return nil, fmt.Errorf("unexpected type %T", dependsOn)
+}
+
+func parseCommand(command interface{}) ([]string, error) {
+	switch command := command.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return splitCommand(command)
+	case []interface{}:
+		return toStrings(command)
+	}
+	return nil, fmt.Errorf("unexpected type %T", command)
+}
+
+func splitCommand(command string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in %q", command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func toStrings(values []interface{}) ([]string, error) {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			strs = append(strs, value)
+		case int, float64, bool:
+			strs = append(strs, fmt.Sprint(value))
+		default:
+			return nil, fmt.Errorf("unexpected type %T", value)
+		}
+	}
+	return strs, nil
+}
+
+func parseBuild(build interface{}, baseDir string) (*ServiceBuild, error) {
+	if build == nil {
+		return nil, nil
+	}
+	var file buildFile
+	if contextPath, ok := build.(string); ok {
+		file.Context = contextPath
+	} else {
+		data, err := yaml.Marshal(build)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(data, &file); err != nil {
+			return nil, err
+		}
+	}
+	if len(file.Extra) > 0 {
+		keys := make([]string, 0, len(file.Extra))
+		for key := range file.Extra {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unsupported build keys: %s", strings.Join(keys, ", "))
+	}
+
+	contextPath := file.Context
+	if contextPath == "" {
+		contextPath = "."
+	}
+	if !path.IsAbs(contextPath) && !strings.Contains(contextPath, "://") {
+		contextPath = path.Join(baseDir, contextPath)
+	}
+	args, err := parseKeyValues(file.Args)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceBuild{
+		ContextPath:    contextPath,
+		DockerfilePath: file.Dockerfile,
+		Args:           args,
+		Target:         file.Target,
+	}, nil
+}
+
+func parseKeyValues(values interface{}) (map[string]string, error) {
+	switch values := values.(type) {
+	case nil:
+		return nil, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]string, len(values))
+		for key, value := range values {
+			if value == nil {
+				result[fmt.Sprint(key)] = ""
+			} else {
+				result[fmt.Sprint(key)] = fmt.Sprint(value)
+			}
+		}
+		return result, nil
+	case []interface{}:
+		strs, err := toStrings(values)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]string, len(strs))
+		for _, str := range strs {
+			parts := strings.SplitN(str, "=", 2)
+			if len(parts) == 1 {
+				parts = append(parts, "")
+			}
+			result[parts[0]] = parts[1]
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unexpected type %T", values)
+}
+
+func (c *Compose) parseServiceNetworks(networks interface{}) ([]ServiceNetworkConfig, error) {
+	configs := map[string]ServiceNetworkConfig{}
+	switch networks := networks.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		names, err := toStrings(networks)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			configs[name] = ServiceNetworkConfig{}
+		}
+	case map[interface{}]interface{}:
+		for name, value := range networks {
+			config := ServiceNetworkConfig{}
+			if value != nil {
+				data, err := yaml.Marshal(value)
+				if err != nil {
+					return nil, err
+				}
+				if err = yaml.Unmarshal(data, &config); err != nil {
+					return nil, err
+				}
+			}
+			configs[fmt.Sprint(name)] = config
+		}
+	default:
+		return nil, fmt.Errorf("unexpected type %T", networks)
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	serviceNetworks := make([]ServiceNetworkConfig, 0, len(names))
+	for _, name := range names {
+		network, found := c.Networks[name]
+		if !found {
+			if name != "default" {
+				return nil, fmt.Errorf("network %s is not declared", name)
+			}
+			network = c.AddNetwork(name, NetworkConfig{})
+		}
+		config := configs[name]
+		config.Network = network
+		serviceNetworks = append(serviceNetworks, config)
+	}
+	return serviceNetworks, nil
+}
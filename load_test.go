@@ -0,0 +1,133 @@
+package dockercompose
+
+import (
+	"flag"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/seppo0010/vortices-dockercompose/os"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func startLoaded(t *testing.T, compose *Compose) string {
+	compose.exec = &exec.FakeCommander{RunHandler: func(cmd *exec.FakeCmd) error { return nil }}
+	fakeOS := &os.FakeOS{}
+	compose.os = fakeOS
+	err := compose.Start()
+	assert.Nil(t, err)
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
+	return string(contents)
+}
+
+func TestLoadComposeGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/load/*.yml")
+	assert.Nil(t, err)
+	assert.NotEqual(t, len(files), 0)
+	for _, file := range files {
+		t.Run(path.Base(file), func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			compose, err := LoadCompose(strings.NewReader(string(data)), "/project")
+			assert.Nil(t, err)
+			contents := startLoaded(t, compose)
+
+			golden := strings.TrimSuffix(file, ".yml") + ".golden"
+			if *update {
+				assert.Nil(t, ioutil.WriteFile(golden, []byte(contents), 0644))
+			}
+			expected, err := ioutil.ReadFile(golden)
+			assert.Nil(t, err)
+			assert.Equal(t, contents, string(expected))
+		})
+	}
+}
+
+func TestLoadComposeTopology(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/load/basic.yml")
+	assert.Nil(t, err)
+	compose, err := LoadCompose(strings.NewReader(string(data)), "/project")
+	assert.Nil(t, err)
+
+	assert.Equal(t, compose.Version, "2.4")
+	assert.Equal(t, len(compose.Services), 2)
+	assert.Equal(t, len(compose.Networks), 2)
+	web := compose.Services["web"]
+	assert.Equal(t, web.Command, []string{"nginx", "-g", "daemon off;"})
+	assert.Equal(t, web.ContainerName, "web")
+	assert.Equal(t, web.Networks["front"].Network, compose.Networks["front"])
+	assert.Equal(t, web.Networks["front"].Aliases, []string{"www"})
+	db := compose.Services["db"]
+	assert.Equal(t, db.ContainerName, "database")
+	assert.Equal(t, db.Networks["back"].Network, compose.Networks["back"])
+	assert.Equal(t, compose.Networks["back"].Extra, map[string]interface{}{"driver": "bridge"})
+}
+
+func TestLoadComposeFileResolvesBuildContext(t *testing.T) {
+	compose, err := LoadComposeFile("testdata/load/build.yml")
+	assert.Nil(t, err)
+	dir, err := filepath.Abs("testdata/load")
+	assert.Nil(t, err)
+
+	app := compose.Services["app"]
+	assert.Equal(t, app.Build.ContextPath, path.Join(dir, "app"))
+	assert.Equal(t, app.Build.DockerfilePath, "Dockerfile.dev")
+	assert.Equal(t, app.Build.Args, map[string]string{"VERSION": "1.0", "DEBUG": ""})
+	assert.Equal(t, app.Command, []string{"./run", "--port", "8080"})
+	assert.Equal(t, compose.Services["worker"].Build.ContextPath, path.Join(dir, "worker"))
+	assert.NotNil(t, compose.Networks["default"])
+}
+
+func TestLoadComposeUndeclaredNetwork(t *testing.T) {
+	_, err := LoadCompose(strings.NewReader("services:\n  web:\n    image: nginx\n    networks:\n    - missing\n"), "/project")
+	assert.Equal(t, err.Error(), "invalid networks for service web: network missing is not declared")
+}
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`sh -c "echo \"hi\" && sleep 1" 'a b'`)
+	assert.Nil(t, err)
+	assert.Equal(t, args, []string{"sh", "-c", `echo "hi" && sleep 1`, "a b"})
+	_, err = splitCommand(`sh -c "echo`)
+	assert.NotNil(t, err)
+}
+
+func TestLoadComposeMultipleSubnets(t *testing.T) {
+	compose, err := LoadCompose(strings.NewReader(`version: "2.4"
+services:
+  web:
+    image: nginx
+    networks:
+      lan:
+        ipv4_address: 10.0.1.2
+  db:
+    image: postgres
+    networks:
+      lan:
+        ipv4_address: 10.0.2.2
+networks:
+  lan:
+    ipam:
+      config:
+      - subnet: 10.0.0.0/24
+      - subnet: 10.0.1.0/24
+        gateway: 10.0.1.1
+  other:
+    ipam:
+      config:
+      - gateway: 10.1.0.1
+`), "/project")
+	assert.Nil(t, err)
+	assert.Equal(t, compose.Networks["lan"].Subnet, "")
+	assert.Equal(t, compose.Networks["lan"].subnets(), []string{"10.0.0.0/24", "10.0.1.0/24"})
+	assert.Equal(t, compose.Validate(), []ValidationProblem{
+		ValidationProblem{Network: "other", Message: "ipam config entry map[gateway:10.1.0.1] has no subnet"},
+		ValidationProblem{Service: "db", Network: "lan", Message: "ipv4 address 10.0.2.2 is outside subnet 10.0.0.0/24, 10.0.1.0/24"},
+	})
+}
@@ -2,41 +2,54 @@ package dockercompose
 
 import (
 	"fmt"
-	"io/ioutil"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type NetworkConfig struct {
+	Subnet string `yaml:"-"`
 }
 
 type Network struct {
 	NetworkConfig `yaml:",inline"`
+	Extra         map[string]interface{} `yaml:",inline"`
 	name          string
 	compose       *Compose
+
+	ipamSubnets []string
+	ipamProblem string
 }
 
-func (n *Network) GetCIDR() (string, error) {
-	networkID := fmt.Sprintf("%s_%s", strings.Replace(n.compose.id, "-", "", -1), n.name)
-	networksExec := n.compose.exec.New("docker", "inspect", "-f", "{{(index .IPAM.Config 0).Subnet}}", networkID)
-	stdout, err := networksExec.StdoutPipe()
-	if err != nil {
-		log.Errorf("failed to pipe network settings stdout: %s", err.Error())
-		return "", err
+func (n *Network) subnets() []string {
+	if n.Subnet != "" {
+		return []string{n.Subnet}
 	}
-	if err := networksExec.Start(); err != nil {
-		log.Errorf("failed to inspect network settings: %s", err.Error())
-		return "", err
+	return n.ipamSubnets
+}
+
+func (n *Network) MarshalYAML() (interface{}, error) {
+	network := make(map[string]interface{}, len(n.Extra)+1)
+	for key, value := range n.Extra {
+		network[key] = value
 	}
-	stdoutStr, err := ioutil.ReadAll(stdout)
-	if err != nil {
-		log.Errorf("failed to read network settings json: %s", err.Error())
-		return "", err
+	if n.Subnet != "" {
+		network["ipam"] = map[string]interface{}{
+			"config": []map[string]string{map[string]string{"subnet": n.Subnet}},
+		}
 	}
-	if err := networksExec.Wait(); err != nil {
-		log.Errorf("failed to wait inspect network settings: %s", err.Error())
+	return network, nil
+}
+
+func (n *Network) id() string {
+	return fmt.Sprintf("%s_%s", strings.Replace(n.compose.id, "-", "", -1), n.name)
+}
+
+func (n *Network) GetCIDR() (string, error) {
+	stdout, err := n.compose.exec.New("docker", "inspect", "-f", "{{(index .IPAM.Config 0).Subnet}}", n.id()).Output()
+	if err != nil {
+		log.Errorf("failed to inspect network settings: %s", err.Error())
 		return "", err
 	}
-	return strings.TrimSpace(string(stdoutStr)), nil
+	return strings.TrimSpace(string(stdout)), nil
 }
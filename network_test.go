@@ -2,7 +2,6 @@ package dockercompose
 
 import (
 	"fmt"
-	"io"
 	"strings"
 	"testing"
 
@@ -11,27 +10,13 @@ import (
 )
 
 func TestCIDR(t *testing.T) {
-	ranCommands := []*exec.FakeCmd{}
 	compose, fakeExec, _ := mockCompose()
-	fakeExec.StdoutHandler = func(f *exec.FakeCmd) (io.ReadCloser, error) {
-		if len(f.Args) == 4 && f.Args[0] == "inspect" && f.Args[1] == "-f" && f.Args[2] == "{{(index .IPAM.Config 0).Subnet}}" && f.Args[3] == fmt.Sprintf("%s_network1", strings.Replace(compose.id, "-", "", -1)) {
-			r, w := io.Pipe()
-			go func() {
-				w.Write([]byte("1.2.3.4/5\n"))
-				w.Close()
-			}()
-			return r, nil
-		}
-		panic("unexpected stdout handler call")
-	}
-
-	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
-		ranCommands = append(ranCommands, cmd)
-		return nil
-	}
+	networkID := fmt.Sprintf("%s_network1", strings.Replace(compose.id, "-", "", -1))
+	fakeExec.Expect("docker", exec.ExactArgs("inspect", "-f", "{{(index .IPAM.Config 0).Subnet}}", networkID)).Stdout("1.2.3.4/5\n")
 
 	network1 := compose.AddNetwork("network1", NetworkConfig{})
 	cidr, err := network1.GetCIDR()
 	assert.Nil(t, err)
 	assert.Equal(t, cidr, "1.2.3.4/5")
+	fakeExec.AssertExpectations(t)
 }
@@ -3,30 +3,151 @@ package os
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-type FakeDir struct {
-	Path string
-	Perm os.FileMode
+type fakeNode struct {
+	dir     bool
+	perm    os.FileMode
+	data    []byte
+	modTime time.Time
 }
 
-type FakeWrittenFile struct {
-	Name     string
-	Contents *bytes.Buffer
+type fakeFileInfo struct {
+	name string
+	node fakeNode
+}
+
+func (f *fakeFileInfo) Name() string {
+	return f.name
+}
+
+func (f *fakeFileInfo) Size() int64 {
+	return int64(len(f.node.data))
+}
+
+func (f *fakeFileInfo) Mode() os.FileMode {
+	if f.node.dir {
+		return os.ModeDir | f.node.perm
+	}
+	return f.node.perm
+}
+
+func (f *fakeFileInfo) ModTime() time.Time {
+	return f.node.modTime
+}
+
+func (f *fakeFileInfo) IsDir() bool {
+	return f.node.dir
+}
+
+func (f *fakeFileInfo) Sys() interface{} {
+	return nil
+}
+
+type fakeFile struct {
+	fakeOS  *FakeOS
+	name    string
+	node    *fakeNode
+	closed  bool
+	written int
+}
+
+func (f *fakeFile) Write(p []byte) (int, error) {
+	f.fakeOS.mutex.Lock()
+	defer f.fakeOS.mutex.Unlock()
+	if f.closed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrClosed}
+	}
+	accepted, err := f.injectedWrite(p)
+	f.node.data = append(f.node.data, accepted...)
+	f.node.modTime = time.Now()
+	f.written += len(accepted)
+	if err != nil {
+		return len(accepted), &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	return len(p), nil
+}
+
+func (f *fakeFile) Close() error {
+	f.fakeOS.mutex.Lock()
+	defer f.fakeOS.mutex.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
 }
 
 type FakeOS struct {
-	Dirs         []FakeDir
-	WrittenFiles []*FakeWrittenFile
+	mutex sync.Mutex
+	nodes map[string]*fakeNode
+
+	faultMutex sync.Mutex
+	faults     []*Fault
+}
+
+func (f *FakeOS) init() {
+	if f.nodes == nil {
+		f.nodes = map[string]*fakeNode{
+			"/":    &fakeNode{dir: true, perm: 0755},
+			"/tmp": &fakeNode{dir: true, perm: 0777},
+		}
+	}
+}
+
+func clean(name string) string {
+	return path.Join("/", name)
 }
 
-func (f *FakeOS) MkdirAll(path string, perm os.FileMode) error {
-	f.Dirs = append(f.Dirs, FakeDir{
-		Path: path,
-		Perm: perm,
-	})
+func (f *FakeOS) parent(op, name string) (*fakeNode, error) {
+	parent, found := f.nodes[path.Dir(name)]
+	if !found {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !parent.dir {
+		return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	if parent.perm&0200 == 0 {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+	return parent, nil
+}
+
+func (f *FakeOS) MkdirAll(dirPath string, perm os.FileMode) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	current := "/"
+	for _, part := range strings.Split(clean(dirPath), "/") {
+		if part == "" {
+			continue
+		}
+		current = path.Join(current, part)
+		if node, found := f.nodes[current]; found {
+			if !node.dir {
+				return &os.PathError{Op: "mkdir", Path: current, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if _, err := f.parent("mkdir", current); err != nil {
+			return err
+		}
+		if err := f.injected(FaultMkdir, current); err != nil {
+			return &os.PathError{Op: "mkdir", Path: current, Err: err}
+		}
+		if _, found := f.nodes[current]; found {
+			continue
+		}
+		f.nodes[current] = &fakeNode{dir: true, perm: perm.Perm(), modTime: time.Now()}
+	}
 	return nil
 }
 
@@ -35,48 +156,174 @@ func (f *FakeOS) TempDir() string {
 }
 
 func (f *FakeOS) Create(name string) (io.WriteCloser, error) {
-	r, w := io.Pipe()
-	buffer := &bytes.Buffer{}
-	go func() { io.Copy(buffer, r) }()
-	f.WrittenFiles = append(f.WrittenFiles, &FakeWrittenFile{
-		Name:     name,
-		Contents: buffer,
-	})
-	return w, nil
-}
-
-func (f *FakeOS) RemoveAll(path string) error {
-	i := 0 // output index
-	for _, x := range f.Dirs {
-		if !strings.HasPrefix(x.Path, path) {
-			// copy and increment index
-			f.Dirs[i] = x
-			i++
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	name = clean(name)
+	if err := f.injected(FaultCreate, name); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	node, found := f.nodes[name]
+	if found {
+		if node.dir {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		if node.perm&0200 == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
 		}
+		node.data = nil
+		node.modTime = time.Now()
+	} else {
+		if _, err := f.parent("open", name); err != nil {
+			return nil, err
+		}
+		node = &fakeNode{perm: 0644, modTime: time.Now()}
+		f.nodes[name] = node
+	}
+	return &fakeFile{fakeOS: f, name: name, node: node}, nil
+}
+
+func (f *FakeOS) Open(name string) (io.ReadCloser, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	name = clean(name)
+	if err := f.injected(FaultOpen, name); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	node, found := f.nodes[name]
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if node.dir {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	if node.perm&0400 == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return ioutil.NopCloser(bytes.NewReader(append([]byte{}, node.data...))), nil
+}
+
+func (f *FakeOS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+func (f *FakeOS) Stat(name string) (os.FileInfo, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	name = clean(name)
+	node, found := f.nodes[name]
+	if !found {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &fakeFileInfo{name: path.Base(name), node: *node}, nil
+}
+
+func (f *FakeOS) ReadDir(name string) ([]os.FileInfo, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	name = clean(name)
+	node, found := f.nodes[name]
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if !node.dir {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	if node.perm&0400 == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
 	}
-	f.Dirs = f.Dirs[:i]
-	i = 0
-	for _, x := range f.WrittenFiles {
-		if !strings.HasPrefix(x.Name, path) {
-			// copy and increment index
-			f.WrittenFiles[i] = x
-			i++
+	infos := []os.FileInfo{}
+	for childPath, child := range f.nodes {
+		if childPath != "/" && path.Dir(childPath) == name {
+			infos = append(infos, &fakeFileInfo{name: path.Base(childPath), node: *child})
 		}
 	}
-	f.WrittenFiles = f.WrittenFiles[:i]
-	return nil
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
 }
 
-func (f *FakeOS) FileExists(path string) bool {
-	for _, dir := range f.Dirs {
-		if strings.HasPrefix(dir.Path, path) {
-			return true
+func (f *FakeOS) Rename(oldpath, newpath string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	oldpath = clean(oldpath)
+	newpath = clean(newpath)
+	if err := f.injected(FaultRename, oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	node, found := f.nodes[oldpath]
+	if !found {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if _, err := f.parent("rename", oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	if _, err := f.parent("rename", newpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	if existing, found := f.nodes[newpath]; found && existing.dir != node.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EEXIST}
+	}
+	if strings.HasPrefix(newpath, oldpath+"/") {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EINVAL}
+	}
+	moved := map[string]*fakeNode{}
+	for childPath, child := range f.nodes {
+		if childPath == oldpath || strings.HasPrefix(childPath, oldpath+"/") {
+			moved[newpath+strings.TrimPrefix(childPath, oldpath)] = child
+			delete(f.nodes, childPath)
 		}
 	}
-	for _, f := range f.WrittenFiles {
-		if f.Name == path {
-			return true
+	for childPath, child := range moved {
+		f.nodes[childPath] = child
+	}
+	return nil
+}
+
+func (f *FakeOS) Chmod(name string, mode os.FileMode) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	name = clean(name)
+	if err := f.injected(FaultChmod, name); err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	node, found := f.nodes[name]
+	if !found {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	node.perm = mode.Perm()
+	return nil
+}
+
+func (f *FakeOS) RemoveAll(removePath string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	removePath = clean(removePath)
+	if err := f.injected(FaultRemove, removePath); err != nil {
+		return &os.PathError{Op: "unlinkat", Path: removePath, Err: err}
+	}
+	for nodePath := range f.nodes {
+		if nodePath == removePath || strings.HasPrefix(nodePath, removePath+"/") {
+			delete(f.nodes, nodePath)
 		}
 	}
-	return false
+	return nil
+}
+
+func (f *FakeOS) FileExists(filePath string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.init()
+	_, found := f.nodes[clean(filePath)]
+	return found
 }
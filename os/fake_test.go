@@ -1,6 +1,7 @@
 package os
 
 import (
+	goos "os"
 	"path"
 	"testing"
 
@@ -58,3 +59,96 @@ func TestFakeFileExists(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, os.FileExists(filePath), false)
 }
+
+func TestFakeFileExistsPrefix(t *testing.T) {
+	os := &FakeOS{}
+	err := os.MkdirAll("/tmp/ab", 0744)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileExists("/tmp/a"), false)
+	assert.Equal(t, os.FileExists("/tmp/ab"), true)
+	err = os.RemoveAll("/tmp/a")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileExists("/tmp/ab"), true)
+}
+
+func TestFakeReadFile(t *testing.T) {
+	os := &FakeOS{}
+	filePath := path.Join(os.TempDir(), "c")
+	f, err := os.Create(filePath)
+	assert.Nil(t, err)
+	f.Write([]byte("hello "))
+	f.Write([]byte("world"))
+	f.Close()
+	contents, err := os.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "hello world")
+
+	_, err = os.ReadFile(path.Join(os.TempDir(), "missing"))
+	assert.True(t, goos.IsNotExist(err))
+}
+
+func TestFakeCreateMissingParent(t *testing.T) {
+	os := &FakeOS{}
+	_, err := os.Create("/tmp/a/b")
+	assert.True(t, goos.IsNotExist(err))
+}
+
+func TestFakeStatReadDir(t *testing.T) {
+	os := &FakeOS{}
+	dir := path.Join(os.TempDir(), "a")
+	err := os.MkdirAll(path.Join(dir, "b"), 0744)
+	assert.Nil(t, err)
+	f, err := os.Create(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	info, err := os.Stat(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Name(), "c")
+	assert.Equal(t, info.Size(), int64(3))
+	assert.Equal(t, info.IsDir(), false)
+
+	infos, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(infos), 2)
+	assert.Equal(t, infos[0].Name(), "b")
+	assert.Equal(t, infos[0].IsDir(), true)
+	assert.Equal(t, infos[0].Mode(), goos.ModeDir|0744)
+	assert.Equal(t, infos[1].Name(), "c")
+}
+
+func TestFakeRename(t *testing.T) {
+	os := &FakeOS{}
+	err := os.MkdirAll("/tmp/a/b", 0744)
+	assert.Nil(t, err)
+	f, err := os.Create("/tmp/a/b/c")
+	assert.Nil(t, err)
+	f.Write([]byte("c"))
+	f.Close()
+
+	err = os.Rename("/tmp/a", "/tmp/d")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileExists("/tmp/a"), false)
+	contents, err := os.ReadFile("/tmp/d/b/c")
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "c")
+}
+
+func TestFakePermissions(t *testing.T) {
+	os := &FakeOS{}
+	err := os.MkdirAll("/tmp/a", 0544)
+	assert.Nil(t, err)
+	_, err = os.Create("/tmp/a/b")
+	assert.True(t, goos.IsPermission(err))
+
+	err = os.Chmod("/tmp/a", 0744)
+	assert.Nil(t, err)
+	f, err := os.Create("/tmp/a/b")
+	assert.Nil(t, err)
+	f.Close()
+	err = os.Chmod("/tmp/a/b", 0200)
+	assert.Nil(t, err)
+	_, err = os.ReadFile("/tmp/a/b")
+	assert.True(t, goos.IsPermission(err))
+}
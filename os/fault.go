@@ -0,0 +1,116 @@
+package os
+
+import (
+	"io"
+	"path"
+	"syscall"
+	"time"
+)
+
+type FaultOp string
+
+const (
+	FaultAny    FaultOp = ""
+	FaultMkdir  FaultOp = "mkdir"
+	FaultCreate FaultOp = "create"
+	FaultWrite  FaultOp = "write"
+	FaultOpen   FaultOp = "open"
+	FaultRemove FaultOp = "remove"
+	FaultRename FaultOp = "rename"
+	FaultChmod  FaultOp = "chmod"
+)
+
+var ErrNoSpace error = syscall.ENOSPC
+
+type Fault struct {
+	Op         FaultOp
+	Path       string
+	Err        error
+	ShortWrite int
+	Delay      time.Duration
+	Times      int
+}
+
+func (f *FakeOS) InjectFault(fault Fault) {
+	f.faultMutex.Lock()
+	defer f.faultMutex.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+func (f *FakeOS) matchFault(op FaultOp, name string, fires func(*Fault) bool) *Fault {
+	f.faultMutex.Lock()
+	defer f.faultMutex.Unlock()
+	for i, fault := range f.faults {
+		if fault.Op != FaultAny && fault.Op != op {
+			continue
+		}
+		if matched, _ := path.Match(fault.Path, name); !matched && fault.Path != "" {
+			continue
+		}
+		if !fires(fault) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+			}
+		}
+		matched := *fault
+		return &matched
+	}
+	return nil
+}
+
+func (f *FakeOS) sleep(delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	f.mutex.Unlock()
+	defer f.mutex.Lock()
+	time.Sleep(delay)
+}
+
+func (f *FakeOS) injected(op FaultOp, name string) error {
+	fault := f.matchFault(op, name, func(fault *Fault) bool {
+		return fault.Err != nil || fault.Delay > 0
+	})
+	if fault == nil {
+		return nil
+	}
+	f.sleep(fault.Delay)
+	return fault.Err
+}
+
+func (f *fakeFile) shortWrite(fault *Fault, p []byte) int {
+	if fault.Err == nil && fault.ShortWrite == 0 {
+		return len(p)
+	}
+	remaining := fault.ShortWrite - f.written
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining < len(p) {
+		return remaining
+	}
+	return len(p)
+}
+
+func (f *fakeFile) injectedWrite(p []byte) ([]byte, error) {
+	fault := f.fakeOS.matchFault(FaultWrite, f.name, func(fault *Fault) bool {
+		return fault.Delay > 0 || f.shortWrite(fault, p) < len(p)
+	})
+	if fault == nil {
+		return p, nil
+	}
+	f.fakeOS.sleep(fault.Delay)
+	accepted := f.shortWrite(fault, p)
+	if accepted == len(p) {
+		return p, nil
+	}
+	err := fault.Err
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return p[:accepted], err
+}
@@ -0,0 +1,105 @@
+package os
+
+import (
+	"errors"
+	goos "os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultMkdirHalfway(t *testing.T) {
+	os := &FakeOS{}
+	os.InjectFault(Fault{Op: FaultMkdir, Path: "/tmp/a/b", Err: goos.ErrPermission})
+	err := os.MkdirAll("/tmp/a/b/c", 0744)
+	assert.True(t, goos.IsPermission(err))
+	assert.Equal(t, os.FileExists("/tmp/a"), true)
+	assert.Equal(t, os.FileExists("/tmp/a/b"), false)
+}
+
+func TestFaultCreateGlob(t *testing.T) {
+	os := &FakeOS{}
+	os.InjectFault(Fault{Op: FaultCreate, Path: "/tmp/*.yml", Err: ErrNoSpace, Times: 1})
+	_, err := os.Create("/tmp/docker-compose.yml")
+	assert.Equal(t, err.(*goos.PathError).Err, ErrNoSpace)
+	f, err := os.Create("/tmp/docker-compose.yml")
+	assert.Nil(t, err)
+	f.Close()
+	f, err = os.Create("/tmp/Dockerfile")
+	assert.Nil(t, err)
+	f.Close()
+}
+
+func TestFaultShortWrite(t *testing.T) {
+	os := &FakeOS{}
+	os.InjectFault(Fault{Op: FaultWrite, Path: "/tmp/c", Err: ErrNoSpace, ShortWrite: 4})
+	f, err := os.Create("/tmp/c")
+	assert.Nil(t, err)
+	n, err := f.Write([]byte("abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 3)
+	n, err = f.Write([]byte("def"))
+	assert.Equal(t, err.(*goos.PathError).Err, ErrNoSpace)
+	assert.Equal(t, n, 1)
+	f.Close()
+	contents, err := os.ReadFile("/tmp/c")
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "abcd")
+}
+
+func TestFaultRemove(t *testing.T) {
+	os := &FakeOS{}
+	expected := errors.New("device busy")
+	os.InjectFault(Fault{Op: FaultRemove, Err: expected})
+	err := os.MkdirAll("/tmp/a", 0744)
+	assert.Nil(t, err)
+	err = os.RemoveAll("/tmp/a")
+	assert.Equal(t, err.(*goos.PathError).Err, expected)
+	assert.Equal(t, os.FileExists("/tmp/a"), true)
+}
+
+func TestFaultDelayDoesNotBlock(t *testing.T) {
+	os := &FakeOS{}
+	os.InjectFault(Fault{Op: FaultCreate, Path: "/tmp/slow", Delay: time.Hour, Times: 1})
+	go os.Create("/tmp/slow")
+	for {
+		os.faultMutex.Lock()
+		pending := len(os.faults)
+		os.faultMutex.Unlock()
+		if pending == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- os.MkdirAll("/tmp/a", 0744)
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("delayed create blocked other operations")
+	}
+}
+
+func TestFaultTimesCountsFiredFaults(t *testing.T) {
+	os := &FakeOS{}
+	os.InjectFault(Fault{Op: FaultWrite, Path: "/tmp/c", Err: ErrNoSpace, ShortWrite: 4, Times: 1})
+	f, err := os.Create("/tmp/c")
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("abc"))
+	assert.Nil(t, err)
+	n, err := f.Write([]byte("def"))
+	assert.Equal(t, err.(*goos.PathError).Err, ErrNoSpace)
+	assert.Equal(t, n, 1)
+	n, err = f.Write([]byte("ghi"))
+	assert.Nil(t, err)
+	assert.Equal(t, n, 3)
+	f.Close()
+	contents, err := os.ReadFile("/tmp/c")
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "abcdghi")
+}
@@ -10,5 +10,11 @@ type OS interface {
 	RemoveAll(path string) error
 	TempDir() string
 	Create(name string) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error)
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode os.FileMode) error
 	FileExists(path string) bool
 }
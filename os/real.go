@@ -2,6 +2,7 @@ package os
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 )
 
@@ -23,6 +24,30 @@ func (*RealOS) Create(name string) (io.WriteCloser, error) {
 	return os.Create(name)
 }
 
+func (*RealOS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (*RealOS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (*RealOS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (*RealOS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (*RealOS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (*RealOS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
 func (*RealOS) FileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil || !os.IsNotExist(err)
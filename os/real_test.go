@@ -1,6 +1,8 @@
 package os
 
 import (
+	"io/ioutil"
+	goos "os"
 	"path"
 	"testing"
 
@@ -58,3 +60,44 @@ func TestRealFileExists(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, os.FileExists(filePath), false)
 }
+
+func TestRealReadFileStatReadDir(t *testing.T) {
+	os := &RealOS{}
+	dir := path.Join(os.TempDir(), "vortices-dockercompose-real-readdir")
+	err := os.MkdirAll(path.Join(dir, "b"), 0744)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	f, err := os.Create(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	f.Write([]byte("hello"))
+	f.Close()
+
+	contents, err := os.ReadFile(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "hello")
+
+	info, err := os.Stat(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), int64(5))
+
+	infos, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(infos), 2)
+	assert.Equal(t, infos[0].Name(), "b")
+	assert.Equal(t, infos[1].Name(), "c")
+
+	err = os.Chmod(path.Join(dir, "c"), 0600)
+	assert.Nil(t, err)
+	info, err = os.Stat(path.Join(dir, "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode(), goos.FileMode(0600))
+
+	err = os.Rename(path.Join(dir, "c"), path.Join(dir, "b", "d"))
+	assert.Nil(t, err)
+	r, err := os.Open(path.Join(dir, "b", "d"))
+	assert.Nil(t, err)
+	contents, err = ioutil.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "hello")
+}
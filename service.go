@@ -3,7 +3,7 @@ package dockercompose
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -12,9 +12,11 @@ import (
 )
 
 type ServiceConfig struct {
-	Image      string
+	Image      string   `yaml:"image,omitempty"`
 	Command    []string `yaml:"command,omitempty"`
 	Privileged bool
+	Build      *ServiceBuild `yaml:"build,omitempty"`
+	DependsOn  Dependencies  `yaml:"depends_on,omitempty"`
 }
 
 type Service struct {
@@ -22,16 +24,25 @@ type Service struct {
 	ContainerName         string `yaml:"container_name"`
 	name                  string
 	Networks              map[string]ServiceNetworkConfig `yaml:"networks"`
+	Extra                 map[string]interface{}          `yaml:",inline"`
 	compose               *Compose
 	serviceNetworksConfig []ServiceNetworkConfig
 }
 
 type ServiceNetworkConfig struct {
-	Network *Network `yaml:"-"`
-	Aliases []string `yaml:"aliases,omitempty"`
+	Network     *Network               `yaml:"-"`
+	Aliases     []string               `yaml:"aliases,omitempty"`
+	IPv4Address string                 `yaml:"ipv4_address,omitempty"`
+	Extra       map[string]interface{} `yaml:",inline"`
 }
 
 func (s *Service) SetNetworks(serviceNetworksConfig []ServiceNetworkConfig) {
+	s.compose.mutex.Lock()
+	defer s.compose.mutex.Unlock()
+	s.setNetworks(serviceNetworksConfig)
+}
+
+func (s *Service) setNetworks(serviceNetworksConfig []ServiceNetworkConfig) {
 	s.serviceNetworksConfig = serviceNetworksConfig
 	s.Networks = make(map[string]ServiceNetworkConfig, len(s.serviceNetworksConfig))
 	for _, network := range s.serviceNetworksConfig {
@@ -39,65 +50,73 @@ func (s *Service) SetNetworks(serviceNetworksConfig []ServiceNetworkConfig) {
 	}
 }
 
+type ExecOptions struct {
+	Env        map[string]string
+	User       string
+	WorkDir    string
+	Detach     bool
+	TTY        bool
+	Privileged bool
+	Stdin      io.Reader
+}
+
 func (s *Service) Exec(path string, args ...string) exec.Cmd {
-	args = append([]string{"exec", "-T", s.name, path}, args...)
-	cmd := s.compose.exec.New("docker-compose", args...)
-	cmd.SetDir(s.compose.getTmpDir())
-	return cmd
+	return s.ExecWithOptions(ExecOptions{}, path, args...)
 }
 
 func (s *Service) SudoExec(path string, args ...string) exec.Cmd {
-	args = append([]string{"exec", "-T", "--privileged", s.name, path}, args...)
-	cmd := s.compose.exec.New("docker-compose", args...)
+	return s.ExecWithOptions(ExecOptions{Privileged: true}, path, args...)
+}
+
+func (s *Service) ExecWithOptions(options ExecOptions, path string, args ...string) exec.Cmd {
+	execArgs := []string{"exec"}
+	if !options.TTY {
+		execArgs = append(execArgs, "-T")
+	}
+	if options.Detach {
+		execArgs = append(execArgs, "-d")
+	}
+	if options.Privileged {
+		execArgs = append(execArgs, "--privileged")
+	}
+	if options.User != "" {
+		execArgs = append(execArgs, "-u", options.User)
+	}
+	if options.WorkDir != "" {
+		execArgs = append(execArgs, "-w", options.WorkDir)
+	}
+	for _, key := range sortedKeys(options.Env) {
+		execArgs = append(execArgs, "-e", fmt.Sprintf("%s=%s", key, options.Env[key]))
+	}
+	execArgs = append(execArgs, s.name, path)
+	cmd := s.compose.exec.New("docker-compose", append(execArgs, args...)...)
 	cmd.SetDir(s.compose.getTmpDir())
+	if options.Stdin != nil {
+		cmd.SetStdin(options.Stdin)
+	}
 	return cmd
 }
 
 func (s *Service) GetIPAddressForNetwork(network *Network) (string, error) {
-	networksExec := s.compose.exec.New("docker", "inspect", "-f", "{{json .NetworkSettings.Networks}}", s.name)
-	stdout, err := networksExec.StdoutPipe()
+	stdout, err := s.compose.exec.New("docker", "inspect", "-f", "{{json .NetworkSettings.Networks}}", s.name).Output()
 	if err != nil {
-		log.Errorf("failed to pipe network settings stdout: %s", err.Error())
-		return "", err
-	}
-	if err := networksExec.Start(); err != nil {
 		log.Errorf("failed to inspect network settings: %s", err.Error())
 		return "", err
 	}
 	var networks map[string]map[string]interface{}
-	err = json.NewDecoder(stdout).Decode(&networks)
+	err = json.Unmarshal(stdout, &networks)
 	if err != nil {
 		log.Errorf("failed to decode network settings json: %s", err.Error())
 		return "", err
 	}
-	if err := networksExec.Wait(); err != nil {
-		log.Errorf("failed to wait inspect network settings: %s", err.Error())
-		return "", err
-	}
 
 	for network_id, data := range networks {
-		networkLabelExec := s.compose.exec.New("docker", "inspect", "-f", "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}", network_id)
-		stdout, err := networkLabelExec.StdoutPipe()
+		stdoutBytes, err := s.compose.exec.New("docker", "inspect", "-f", "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}", network_id).Output()
 		if err != nil {
-			log.Errorf("failed to pipe network label settings stdout: %s", err.Error())
-			return "", err
-		}
-
-		if err = networkLabelExec.Start(); err != nil {
 			log.Errorf("failed to run network label settings: %s", err.Error())
 			return "", err
 		}
 
-		stdoutBytes, err := ioutil.ReadAll(stdout)
-		if err != nil {
-			log.Errorf("failed to read network label settings stdout: %s", err.Error())
-			return "", err
-		}
-		if err = networkLabelExec.Wait(); err != nil {
-			log.Errorf("failed to wait network label settings stdout: %s", err.Error())
-			return "", err
-		}
-
 		if strings.Trim(string(stdoutBytes), " \n") == network.name {
 			ip, found := data["IPAddress"]
 			if !found {
@@ -3,7 +3,8 @@ package dockercompose
 import (
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/seppo0010/vortices-dockercompose/exec"
@@ -11,44 +12,16 @@ import (
 )
 
 func TestIPAddressForNetwork(t *testing.T) {
-	ranCommands := []*exec.FakeCmd{}
 	compose, fakeExec, _ := mockCompose()
-	fakeExec.StdoutHandler = func(f *exec.FakeCmd) (io.ReadCloser, error) {
-		if len(f.Args) == 4 && f.Args[0] == "inspect" && f.Args[1] == "-f" && f.Args[2] == "{{json .NetworkSettings.Networks}}" && f.Args[3] == "test-service" {
-			r, w := io.Pipe()
-			go func() {
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"network1": map[string]interface{}{"IPAddress": "1.2.3.4"},
-					"network2": map[string]interface{}{"IPAddress": "5.6.7.8"},
-				})
-				w.Close()
-			}()
-			return r, nil
-		}
-		if len(f.Args) == 4 && f.Args[0] == "inspect" && f.Args[1] == "-f" && f.Args[2] == "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}" && f.Args[3] == "network1" {
-			r, w := io.Pipe()
-			go func() {
-				w.Write([]byte("network1 \n"))
-				w.Close()
-			}()
-			return r, nil
-		}
-		if len(f.Args) == 4 && f.Args[0] == "inspect" && f.Args[1] == "-f" && f.Args[2] == "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}" && f.Args[3] == "network2" {
-			r, w := io.Pipe()
-			go func() {
-				w.Write([]byte("network2 \n"))
-				w.Close()
-			}()
-			return r, nil
-		}
-
-		panic("unexpected stdout handler call")
-	}
-
-	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
-		ranCommands = append(ranCommands, cmd)
-		return nil
-	}
+	labelFormat := "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}"
+	networks, err := json.Marshal(map[string]interface{}{
+		"network1": map[string]interface{}{"IPAddress": "1.2.3.4"},
+		"network2": map[string]interface{}{"IPAddress": "5.6.7.8"},
+	})
+	assert.Nil(t, err)
+	fakeExec.Expect("docker", exec.ExactArgs("inspect", "-f", "{{json .NetworkSettings.Networks}}", "test-service")).Stdout(string(networks))
+	fakeExec.Expect("docker", exec.ExactArgs("inspect", "-f", labelFormat, "network1")).Stdout("network1 \n").AnyTimes()
+	fakeExec.Expect("docker", exec.ExactArgs("inspect", "-f", labelFormat, "network2")).Stdout("network2 \n")
 
 	network1 := compose.AddNetwork("network1", NetworkConfig{})
 	network2 := compose.AddNetwork("network2", NetworkConfig{})
@@ -59,6 +32,7 @@ func TestIPAddressForNetwork(t *testing.T) {
 	ipAddress, err := service.GetIPAddressForNetwork(network2)
 	assert.Nil(t, err)
 	assert.Equal(t, ipAddress, "5.6.7.8")
+	fakeExec.AssertExpectations(t)
 }
 
 func TestExec(t *testing.T) {
@@ -96,3 +70,45 @@ func TestSudoExec(t *testing.T) {
 	assert.Equal(t, ranCommands[0].Args, []string{"exec", "-T", "--privileged", "test-service", "ping", "google.com"})
 	assert.Equal(t, ranCommands[0].Dir, fmt.Sprintf("/tmp/vortices-dockercompose/%s", compose.id))
 }
+
+func TestExecWithOptions(t *testing.T) {
+	ranCommands := []*exec.FakeCmd{}
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
+		ranCommands = append(ranCommands, cmd)
+		return &exec.ExitError{Code: 3}
+	}
+
+	service := compose.AddService("test-service", ServiceConfig{}, []ServiceNetworkConfig{})
+	cmd := service.ExecWithOptions(ExecOptions{
+		Env:     map[string]string{"B": "2", "A": "1"},
+		User:    "nobody",
+		WorkDir: "/srv",
+		Detach:  true,
+		TTY:     true,
+	}, "ping", "google.com")
+	assert.Equal(t, cmd.ExitCode(), -1)
+	err := cmd.Run()
+	assert.NotNil(t, err)
+	assert.Equal(t, cmd.ExitCode(), 3)
+	assert.Equal(t, len(ranCommands), 1)
+	assert.Equal(t, ranCommands[0].Path, "docker-compose")
+	assert.Equal(t, ranCommands[0].Args, []string{"exec", "-d", "-u", "nobody", "-w", "/srv", "-e", "A=1", "-e", "B=2", "test-service", "ping", "google.com"})
+}
+
+func TestExecWithOptionsStdin(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	var stdin []byte
+	fakeExec.RunHandler = func(cmd *exec.FakeCmd) error {
+		var err error
+		stdin, err = ioutil.ReadAll(cmd.Stdin)
+		return err
+	}
+
+	service := compose.AddService("test-service", ServiceConfig{}, []ServiceNetworkConfig{})
+	cmd := service.ExecWithOptions(ExecOptions{Stdin: strings.NewReader("hello")}, "cat")
+	err := cmd.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, cmd.ExitCode(), 0)
+	assert.Equal(t, string(stdin), "hello")
+}
@@ -0,0 +1,159 @@
+package dockercompose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/seppo0010/vortices-dockercompose/os"
+)
+
+const stateFileName = "state.json"
+
+var composeStatusNames = map[composeStatus]string{
+	composeStatusSetup:   "setup",
+	composeStatusRunning: "running",
+	composeStatusStopped: "stopped",
+}
+
+type composeState struct {
+	ID              string                `json:"id"`
+	TmpDir          string                `json:"tmp_dir"`
+	Status          string                `json:"status"`
+	Offline         bool                  `json:"offline,omitempty"`
+	BuiltImages     []string              `json:"built_images,omitempty"`
+	PendingServices []string              `json:"pending_services,omitempty"`
+	PendingNetworks []string              `json:"pending_networks,omitempty"`
+	Builds          map[string]buildState `json:"builds,omitempty"`
+	Compose         string                `json:"compose"`
+}
+
+type buildState struct {
+	Dockerfile     string            `json:"dockerfile,omitempty"`
+	Context        BuildContext      `json:"context,omitempty"`
+	DockerfilePath string            `json:"dockerfile_path,omitempty"`
+	Args           map[string]string `json:"args,omitempty"`
+	Target         string            `json:"target,omitempty"`
+}
+
+func (c *Compose) ID() string {
+	return c.id
+}
+
+func (c *Compose) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.save()
+}
+
+func (c *Compose) save() error {
+	var compose bytes.Buffer
+	if err := c.render(&compose); err != nil {
+		return err
+	}
+	builds := map[string]buildState{}
+	for name, service := range c.Services {
+		if service.Build != nil && service.Build.ContextPath == "" {
+			builds[name] = buildState{
+				Dockerfile:     service.Build.Dockerfile,
+				Context:        service.Build.Context,
+				DockerfilePath: service.Build.DockerfilePath,
+				Args:           service.Build.Args,
+				Target:         service.Build.Target,
+			}
+		}
+	}
+	data, err := json.MarshalIndent(composeState{
+		ID:              c.id,
+		TmpDir:          c.getTmpDir(),
+		Status:          composeStatusNames[c.status],
+		Offline:         c.Offline,
+		BuiltImages:     c.BuiltImages(),
+		PendingServices: c.pendingServices,
+		PendingNetworks: c.pendingNetworks,
+		Builds:          builds,
+		Compose:         compose.String(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = c.os.MkdirAll(c.getTmpDir(), 0744); err != nil {
+		return err
+	}
+	statePath := path.Join(c.getTmpDir(), stateFileName)
+	f, err := c.os.Create(statePath + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return c.os.Rename(statePath+".tmp", statePath)
+}
+
+func Attach(id string) (*Compose, error) {
+	return attach(&os.RealOS{}, &exec.RealCommander{}, id)
+}
+
+func attach(osImpl os.OS, execImpl exec.Commander, id string) (*Compose, error) {
+	return loadState(osImpl, execImpl, path.Join(osImpl.TempDir(), "vortices-dockercompose", id, stateFileName))
+}
+
+func LoadState(statePath string) (*Compose, error) {
+	return loadState(&os.RealOS{}, &exec.RealCommander{}, statePath)
+}
+
+func loadState(osImpl os.OS, execImpl exec.Commander, statePath string) (*Compose, error) {
+	data, err := osImpl.ReadFile(statePath)
+	if err != nil {
+		return nil, err
+	}
+	var state composeState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse compose state %s: %s", statePath, err.Error())
+	}
+
+	compose := NewCompose(ComposeConfig{Offline: state.Offline})
+	compose.os = osImpl
+	compose.exec = execImpl
+	compose.id = state.ID
+	compose.tmpDir = state.TmpDir
+	if err = compose.load([]byte(state.Compose), state.TmpDir); err != nil {
+		return nil, err
+	}
+	for name, build := range state.Builds {
+		service, found := compose.Services[name]
+		if !found {
+			return nil, fmt.Errorf("build for unknown service %s in %s", name, statePath)
+		}
+		service.Build = &ServiceBuild{
+			Dockerfile:     build.Dockerfile,
+			Context:        build.Context,
+			DockerfilePath: build.DockerfilePath,
+			Args:           build.Args,
+			Target:         build.Target,
+		}
+	}
+
+	found := false
+	for status, name := range composeStatusNames {
+		if name == state.Status {
+			compose.status = status
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("invalid compose status %q in %s", state.Status, statePath)
+	}
+	compose.builtImages = state.BuiltImages
+	compose.pendingServices = state.PendingServices
+	compose.pendingNetworks = state.PendingNetworks
+	return compose, nil
+}
@@ -0,0 +1,104 @@
+package dockercompose
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/seppo0010/vortices-dockercompose/os"
+)
+
+func TestAttach(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	built := expectBuild(fakeExec, "0123456789ab")
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "--build"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("logs", "--no-color", "peer")).Stdout("peer | ready\n")
+	fakeExec.Expect("docker-compose", exec.ExactArgs("exec", "-T", "peer", "hostname")).Stdout("peer\n")
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down"))
+	network := compose.AddNetwork("lan", NetworkConfig{Subnet: "10.0.0.0/24"})
+	compose.AddService("peer", ServiceConfig{
+		Image:   "ubuntu",
+		Command: []string{"sleep", "infinity"},
+	}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, Aliases: []string{"client"}, IPv4Address: "10.0.0.2"},
+	})
+	compose.AddService("builder", ServiceConfig{Build: &ServiceBuild{Dockerfile: "FROM ubuntu"}}, nil)
+	_, err := compose.BuildDocker("tool", "FROM ubuntu")
+	assert.Nil(t, err)
+	assert.Nil(t, compose.Start())
+
+	attached, err := attach(fakeOS, fakeExec, compose.ID())
+	assert.Nil(t, err)
+	assert.Equal(t, attached.ID(), compose.ID())
+	assert.Equal(t, attached.getTmpDir(), compose.getTmpDir())
+	assert.Equal(t, attached.status, composeStatusRunning)
+	assert.Equal(t, attached.BuiltImages(), []string{built})
+	assert.Equal(t, attached.Services["peer"].Command, []string{"sleep", "infinity"})
+	assert.Equal(t, attached.Services["peer"].Networks["lan"].IPv4Address, "10.0.0.2")
+	assert.Equal(t, attached.Networks["lan"].Subnet, "10.0.0.0/24")
+	assert.Equal(t, attached.Services["builder"].Build, &ServiceBuild{Dockerfile: "FROM ubuntu"})
+	var rendered, attachedRendered bytes.Buffer
+	assert.Nil(t, compose.Render(&rendered))
+	assert.Nil(t, attached.Render(&attachedRendered))
+	assert.Equal(t, attachedRendered.String(), rendered.String())
+
+	logs, err := attached.Logs("peer")
+	assert.Nil(t, err)
+	assert.Equal(t, logs, "peer | ready\n")
+	out, err := attached.Services["peer"].Exec("hostname").Output()
+	assert.Nil(t, err)
+	assert.Equal(t, string(out), "peer\n")
+	assert.Nil(t, attached.Stop())
+	assert.Nil(t, attached.Clear())
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestLoadStateAfterStop(t *testing.T) {
+	compose, _, fakeOS := mockCompose()
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+	assert.Nil(t, compose.Stop())
+
+	restored, err := loadState(fakeOS, &exec.FakeCommander{}, path.Join(compose.getTmpDir(), "state.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, restored.status, composeStatusStopped)
+}
+
+func TestStartFailsKeepsStatus(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d")).ExitCode(1)
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Equal(t, compose.Start().Error(), "failed to start docker-compose")
+	assert.Equal(t, compose.status, composeStatusSetup)
+
+	restored, err := loadState(fakeOS, &exec.FakeCommander{}, path.Join(compose.getTmpDir(), "state.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, restored.status, composeStatusSetup)
+
+	assert.Nil(t, compose.Start())
+	assert.Equal(t, compose.status, composeStatusRunning)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestAttachUnknown(t *testing.T) {
+	_, err := attach(&os.FakeOS{}, &exec.FakeCommander{}, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestLoadStateInvalid(t *testing.T) {
+	fakeOS := &os.FakeOS{}
+	f, err := fakeOS.Create("/tmp/state.json")
+	assert.Nil(t, err)
+	f.Write([]byte(`{"id": "abc", "status": "exploded", "compose": "services: {}\n"}`))
+	f.Close()
+
+	_, err = loadState(fakeOS, &exec.FakeCommander{}, "/tmp/state.json")
+	assert.Equal(t, err.Error(), `invalid compose status "exploded" in /tmp/state.json`)
+}
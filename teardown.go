@@ -0,0 +1,159 @@
+package dockercompose
+
+import (
+	"fmt"
+	goos "os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var teardownSignals = []goos.Signal{goos.Interrupt, syscall.SIGTERM}
+
+type teardownHandler struct {
+	mutex   sync.Mutex
+	guards  map[*TeardownGuard]bool
+	signals chan goos.Signal
+	done    chan struct{}
+	firing  bool
+
+	notify func(chan<- goos.Signal, ...goos.Signal)
+	stop   func(chan<- goos.Signal)
+	raise  func(goos.Signal) error
+}
+
+var defaultTeardownHandler = &teardownHandler{
+	notify: signal.Notify,
+	stop:   signal.Stop,
+	raise:  raiseSignal,
+}
+
+type TeardownGuard struct {
+	compose *Compose
+	timeout time.Duration
+	handler *teardownHandler
+	once    sync.Once
+}
+
+func raiseSignal(sig goos.Signal) error {
+	process, err := goos.FindProcess(goos.Getpid())
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+func (c *Compose) GuardTeardown(timeout time.Duration) *TeardownGuard {
+	guard := &TeardownGuard{compose: c, timeout: timeout, handler: defaultTeardownHandler}
+	guard.handler.register(guard)
+	return guard
+}
+
+func (g *TeardownGuard) Release() {
+	g.once.Do(func() {
+		g.handler.unregister(g)
+	})
+}
+
+func (h *teardownHandler) register(guard *TeardownGuard) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.guards == nil {
+		h.guards = map[*TeardownGuard]bool{}
+	}
+	h.guards[guard] = true
+	if h.signals == nil && !h.firing {
+		h.signals = make(chan goos.Signal, 1)
+		h.done = make(chan struct{})
+		h.notify(h.signals, teardownSignals...)
+		go h.wait(h.signals, h.done)
+	}
+}
+
+func (h *teardownHandler) unregister(guard *TeardownGuard) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.guards, guard)
+	if len(h.guards) == 0 && h.signals != nil && !h.firing {
+		close(h.done)
+		h.release()
+	}
+}
+
+func (h *teardownHandler) release() {
+	h.stop(h.signals)
+	h.signals = nil
+	h.done = nil
+}
+
+func (h *teardownHandler) wait(signals chan goos.Signal, done chan struct{}) {
+	select {
+	case sig := <-signals:
+		h.mutex.Lock()
+		guards := h.guards
+		h.guards = nil
+		h.firing = true
+		h.mutex.Unlock()
+
+		log.Infof("received %s, tearing down %d docker composes", sig, len(guards))
+		var wg sync.WaitGroup
+		for guard := range guards {
+			wg.Add(1)
+			go func(guard *TeardownGuard) {
+				defer wg.Done()
+				if err := guard.compose.teardown(guard.timeout); err != nil {
+					log.Errorf("failed to tear down docker compose %s: %s", guard.compose.ID(), err.Error())
+				}
+			}(guard)
+		}
+		wg.Wait()
+		h.mutex.Lock()
+		h.release()
+		h.mutex.Unlock()
+		if err := h.raise(sig); err != nil {
+			log.Errorf("failed to raise %s: %s", sig, err.Error())
+		}
+	case <-done:
+	}
+}
+
+func (c *Compose) teardown(timeout time.Duration) error {
+	finished := make(chan error, 1)
+	go func() {
+		c.mutex.Lock()
+		running := c.status == composeStatusRunning
+		c.mutex.Unlock()
+		var stopErr error
+		if running {
+			stopErr = c.Stop()
+		}
+		err := c.Clear()
+		if stopErr != nil {
+			if err != nil {
+				log.Errorf("failed to clear docker compose %s: %s", c.ID(), err.Error())
+			}
+			err = stopErr
+		}
+		finished <- err
+	}()
+
+	select {
+	case err := <-finished:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("docker compose teardown timed out after %s", timeout)
+	}
+}
+
+func CleanupOnExit(compose *Compose, timeout time.Duration) func() {
+	guard := compose.GuardTeardown(timeout)
+	return func() {
+		guard.Release()
+		if err := compose.teardown(timeout); err != nil {
+			log.Errorf("failed to tear down docker compose: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package dockercompose
+
+import (
+	"fmt"
+	goos "os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+	"github.com/seppo0010/vortices-dockercompose/os"
+)
+
+func fakeTeardownHandler() (*teardownHandler, chan chan<- goos.Signal, chan goos.Signal, chan bool) {
+	notified := make(chan chan<- goos.Signal, 1)
+	raised := make(chan goos.Signal, 2)
+	stopped := make(chan bool, 2)
+	handler := &teardownHandler{
+		notify: func(c chan<- goos.Signal, signals ...goos.Signal) {
+			notified <- c
+		},
+		stop: func(c chan<- goos.Signal) {
+			stopped <- true
+		},
+		raise: func(sig goos.Signal) error {
+			raised <- sig
+			return nil
+		},
+	}
+	return handler, notified, raised, stopped
+}
+
+func fakeGuard(compose *Compose, timeout time.Duration) (*TeardownGuard, chan chan<- goos.Signal, chan goos.Signal, chan bool) {
+	handler, notified, raised, stopped := fakeTeardownHandler()
+	guard := &TeardownGuard{compose: compose, timeout: timeout, handler: handler}
+	handler.register(guard)
+	return guard, notified, raised, stopped
+}
+
+func TestTeardownGuardOnSignal(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down"))
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+
+	_, notified, raised, stopped := fakeGuard(compose, time.Second)
+	(<-notified) <- syscall.SIGTERM
+
+	assert.Equal(t, <-raised, syscall.SIGTERM)
+	assert.True(t, <-stopped)
+	assert.Equal(t, compose.status, composeStatusStopped)
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestTeardownGuardTimeout(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down")).Delay(time.Hour)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+
+	_, notified, raised, _ := fakeGuard(compose, 10*time.Millisecond)
+	(<-notified) <- goos.Interrupt
+
+	select {
+	case sig := <-raised:
+		assert.Equal(t, sig, goos.Interrupt)
+	case <-time.After(time.Second):
+		t.Fatal("signal was not raised after the teardown timeout")
+	}
+}
+
+func TestTeardownGuardRelease(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+
+	guard, _, raised, stopped := fakeGuard(compose, time.Second)
+	guard.Release()
+	guard.Release()
+
+	assert.True(t, <-stopped)
+	select {
+	case <-raised:
+		t.Fatal("signal raised after release")
+	case <-time.After(10 * time.Millisecond):
+	}
+	fakeExec.AssertExpectations(t)
+}
+
+func TestCleanupOnExit(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down"))
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+
+	cleanup := CleanupOnExit(compose, time.Second)
+	assert.Nil(t, compose.Start())
+	cleanup()
+
+	assert.Equal(t, compose.status, composeStatusStopped)
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestTeardownGuardMultipleComposes(t *testing.T) {
+	handler, notified, raised, stopped := fakeTeardownHandler()
+	composes := []*Compose{}
+	fakeOSes := []*os.FakeOS{}
+	for i, delay := range []time.Duration{0, 20 * time.Millisecond} {
+		compose, fakeExec, fakeOS := mockCompose()
+		fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+		fakeExec.Expect("docker-compose", exec.ExactArgs("down")).Delay(delay)
+		compose.AddService(fmt.Sprintf("peer%d", i), ServiceConfig{Image: "ubuntu"}, nil)
+		assert.Nil(t, compose.Start())
+		handler.register(&TeardownGuard{compose: compose, timeout: time.Second, handler: handler})
+		composes = append(composes, compose)
+		fakeOSes = append(fakeOSes, fakeOS)
+	}
+
+	(<-notified) <- syscall.SIGTERM
+
+	assert.Equal(t, <-raised, syscall.SIGTERM)
+	for i, compose := range composes {
+		assert.Equal(t, compose.status, composeStatusStopped)
+		assert.False(t, fakeOSes[i].FileExists(compose.getTmpDir()))
+	}
+	assert.True(t, <-stopped)
+	select {
+	case <-raised:
+		t.Fatal("signal raised more than once")
+	case <-stopped:
+		t.Fatal("signal handler stopped more than once")
+	case <-notified:
+		t.Fatal("signal handler registered more than once")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestTeardownGuardReleaseKeepsOtherGuards(t *testing.T) {
+	handler, notified, raised, stopped := fakeTeardownHandler()
+	first, _, _ := mockCompose()
+	second, _, _ := mockCompose()
+	firstGuard := &TeardownGuard{compose: first, timeout: time.Second, handler: handler}
+	secondGuard := &TeardownGuard{compose: second, timeout: time.Second, handler: handler}
+	handler.register(firstGuard)
+	handler.register(secondGuard)
+	signals := <-notified
+
+	firstGuard.Release()
+	select {
+	case <-stopped:
+		t.Fatal("signal handler stopped while a guard is still registered")
+	default:
+	}
+
+	signals <- goos.Interrupt
+	assert.Equal(t, <-raised, goos.Interrupt)
+	assert.True(t, <-stopped)
+	secondGuard.Release()
+}
+
+func TestTeardownGuardRegisterWhileFiring(t *testing.T) {
+	handler, notified, raised, stopped := fakeTeardownHandler()
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down")).Delay(20 * time.Millisecond)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+	handler.register(&TeardownGuard{compose: compose, timeout: time.Second, handler: handler})
+
+	(<-notified) <- syscall.SIGTERM
+	other, _, _ := mockCompose()
+	otherGuard := &TeardownGuard{compose: other, timeout: time.Second, handler: handler}
+	handler.register(otherGuard)
+	otherGuard.Release()
+
+	assert.Equal(t, <-raised, syscall.SIGTERM)
+	assert.True(t, <-stopped)
+	handler.register(&TeardownGuard{compose: other, timeout: time.Second, handler: handler})
+	select {
+	case <-notified:
+		t.Fatal("signal handler re-armed while tearing down")
+	case <-stopped:
+		t.Fatal("signal handler stopped more than once")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestTeardownClearsWhenStopFails(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("down")).ExitCode(1)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+
+	assert.Equal(t, compose.teardown(time.Second).Error(), "failed to stop docker-compose")
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
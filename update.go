@@ -0,0 +1,166 @@
+package dockercompose
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func removeString(values []string, value string) []string {
+	result := []string{}
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (c *Compose) Update() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.status != composeStatusRunning {
+		return errors.New("cannot update if status is not running")
+	}
+	if len(c.pendingServices) == 0 {
+		if len(c.pendingNetworks) == 0 {
+			return nil
+		}
+		if problems := c.validate(); len(problems) > 0 {
+			return &ValidationError{Problems: problems}
+		}
+		if _, err := c.writeComposeFile(); err != nil {
+			return err
+		}
+		return c.createOrphanNetworks([]string{})
+	}
+	return c.startServices(c.pendingServices)
+}
+
+func (c *Compose) usesNetwork(services []string, name string) bool {
+	for _, serviceName := range services {
+		if serviceNetwork, found := c.Services[serviceName].Networks[name]; found && serviceNetwork.Network == c.Networks[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compose) waitingServices(services []string) []string {
+	waiting := []string{}
+	for _, name := range c.pendingServices {
+		if !containsString(services, name) {
+			waiting = append(waiting, name)
+		}
+	}
+	return waiting
+}
+
+func (c *Compose) createOrphanNetworks(services []string) error {
+	waiting := c.waitingServices(services)
+	for _, name := range c.pendingNetworks {
+		if c.usesNetwork(services, name) || c.usesNetwork(waiting, name) {
+			continue
+		}
+		if err := c.createNetwork(name); err != nil {
+			return err
+		}
+		c.pendingNetworks = removeString(c.pendingNetworks, name)
+	}
+	return nil
+}
+
+func (c *Compose) createNetwork(name string) error {
+	network := c.Networks[name]
+	args := []string{
+		"network", "create",
+		"--label", "com.docker.compose.project=" + strings.Replace(c.id, "-", "", -1),
+		"--label", "com.docker.compose.network=" + name,
+	}
+	for key := range network.Extra {
+		if key != "driver" && key != "internal" {
+			return fmt.Errorf("cannot create network %s while running, unsupported option %s", name, key)
+		}
+	}
+	if driver, ok := network.Extra["driver"].(string); ok {
+		args = append(args, "--driver", driver)
+	}
+	if internal, ok := network.Extra["internal"].(bool); ok && internal {
+		args = append(args, "--internal")
+	}
+	if network.Subnet != "" {
+		args = append(args, "--subnet", network.Subnet)
+	}
+
+	log.Infof("creating docker network %s", name)
+	defer log.Infof("finished creating docker network %s", name)
+
+	_, err := c.execOrFail("create docker network", "docker", append(args, network.id())...)
+	if err != nil {
+		return fmt.Errorf("failed to create docker network %s", name)
+	}
+	return nil
+}
+
+func (c *Compose) RemoveService(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, found := c.Services[name]; !found {
+		return fmt.Errorf("unknown service %s", name)
+	}
+	for _, other := range c.serviceNames() {
+		if _, found := c.Services[other].DependsOn[name]; found {
+			return fmt.Errorf("cannot remove service %s, service %s depends on it", name, other)
+		}
+	}
+
+	if c.status == composeStatusRunning && !containsString(c.pendingServices, name) {
+		log.Infof("removing docker compose service %s", name)
+		defer log.Infof("finished removing docker compose service %s", name)
+
+		_, err := c.execOrFail("remove docker compose service", "docker-compose", "rm", "-s", "-f", name)
+		if err != nil {
+			return fmt.Errorf("failed to remove docker-compose service %s", name)
+		}
+	}
+	delete(c.Services, name)
+	c.pendingServices = removeString(c.pendingServices, name)
+	if c.status == composeStatusRunning {
+		_, err := c.writeComposeFile()
+		return err
+	}
+	return nil
+}
+
+func (c *Compose) RemoveNetwork(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	network, found := c.Networks[name]
+	if !found {
+		return fmt.Errorf("unknown network %s", name)
+	}
+	for _, serviceName := range c.serviceNames() {
+		if serviceNetwork, found := c.Services[serviceName].Networks[name]; found && serviceNetwork.Network == network {
+			return fmt.Errorf("cannot remove network %s, service %s uses it", name, serviceName)
+		}
+	}
+
+	if c.status == composeStatusRunning && !containsString(c.pendingNetworks, name) {
+		log.Infof("removing docker network %s", name)
+		defer log.Infof("finished removing docker network %s", name)
+
+		_, err := c.execOrFail("remove docker network", "docker", "network", "rm", network.id())
+		if err != nil {
+			return fmt.Errorf("failed to remove docker network %s", name)
+		}
+	}
+	delete(c.Networks, name)
+	c.pendingNetworks = removeString(c.pendingNetworks, name)
+	if c.status == composeStatusRunning {
+		_, err := c.writeComposeFile()
+		return err
+	}
+	return nil
+}
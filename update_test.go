@@ -0,0 +1,161 @@
+package dockercompose
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+func TestAddServiceWhileRunning(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "stun", "peer"))
+	network := compose.AddNetwork("lan", NetworkConfig{})
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network},
+	})
+	assert.Nil(t, compose.Start())
+
+	wan := compose.AddNetwork("wan", NetworkConfig{})
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"stun": ""}}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: wan},
+	})
+	assert.Nil(t, compose.Update())
+	assert.Nil(t, compose.Update())
+
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(contents), "  peer:\n"))
+	assert.True(t, strings.Contains(string(contents), "  wan: {}\n"))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestUpdateNotRunning(t *testing.T) {
+	compose, _, _ := mockCompose()
+	assert.Equal(t, compose.Update().Error(), "cannot update if status is not running")
+}
+
+func TestRemoveServiceWhileRunning(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("rm", "-s", "-f", "peer"))
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"stun": ""}}, nil)
+	assert.Nil(t, compose.Start())
+
+	assert.Equal(t, compose.RemoveService("stun").Error(), "cannot remove service stun, service peer depends on it")
+	assert.Equal(t, compose.RemoveService("ghost").Error(), "unknown service ghost")
+	assert.Nil(t, compose.RemoveService("peer"))
+	_, found := compose.Services["peer"]
+	assert.False(t, found)
+
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(contents), "peer"))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRemovePendingService(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	assert.Nil(t, compose.Start())
+
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.RemoveService("peer"))
+	assert.Nil(t, compose.Update())
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRemoveNetworkWhileRunning(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("rm", "-s", "-f", "peer"))
+	fakeExec.Expect("docker", exec.ExactArgs("network", "rm", strings.Replace(compose.id, "-", "", -1)+"_lan"))
+	network := compose.AddNetwork("lan", NetworkConfig{})
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network},
+	})
+	assert.Nil(t, compose.Start())
+
+	assert.Equal(t, compose.RemoveNetwork("lan").Error(), "cannot remove network lan, service peer uses it")
+	assert.Nil(t, compose.RemoveService("peer"))
+	assert.Nil(t, compose.RemoveNetwork("lan"))
+	_, found := compose.Networks["lan"]
+	assert.False(t, found)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRemoveServiceFails(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("rm", "-s", "-f", "peer")).ExitCode(1)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+	assert.Nil(t, compose.Start())
+
+	assert.Equal(t, compose.RemoveService("peer").Error(), "failed to remove docker-compose service peer")
+	_, found := compose.Services["peer"]
+	assert.True(t, found)
+	fakeExec.AssertExpectations(t)
+}
+
+func TestUpdateCreatesOrphanNetwork(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	project := strings.Replace(compose.id, "-", "", -1)
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	fakeExec.Expect("docker", exec.ExactArgs(
+		"network", "create",
+		"--label", "com.docker.compose.project="+project,
+		"--label", "com.docker.compose.network=wan",
+		"--subnet", "10.0.0.0/24",
+		project+"_wan",
+	))
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	assert.Nil(t, compose.Start())
+
+	compose.AddNetwork("wan", NetworkConfig{Subnet: "10.0.0.0/24"})
+	assert.Nil(t, compose.Update())
+	assert.Nil(t, compose.Update())
+
+	contents, err := fakeOS.ReadFile(path.Join(compose.getTmpDir(), "docker-compose.yml"))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(contents), "  wan:\n"))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestUpdateOrphanNetworkUnsupportedOption(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d"))
+	compose.AddService("stun", ServiceConfig{Image: "coturn/coturn"}, nil)
+	assert.Nil(t, compose.Start())
+
+	compose.AddNetwork("wan", NetworkConfig{}).Extra = map[string]interface{}{"attachable": true}
+	assert.Equal(t, compose.Update().Error(), "cannot create network wan while running, unsupported option attachable")
+	fakeExec.AssertExpectations(t)
+}
+
+func TestUpdateBuildsOnlyPendingServices(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	fakeExec.InOrder()
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "--build"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "stun", "peer"))
+	fakeExec.Expect("docker-compose", exec.ExactArgs("up", "-d", "--build", "stun", "relay"))
+	compose.AddService("stun", ServiceConfig{Build: &ServiceBuild{Dockerfile: "FROM coturn/coturn"}}, nil)
+	assert.Nil(t, compose.Start())
+
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu", DependsOn: Dependencies{"stun": ""}}, nil)
+	assert.Nil(t, compose.Update())
+
+	compose.AddService("relay", ServiceConfig{Build: &ServiceBuild{Dockerfile: "FROM ubuntu"}, DependsOn: Dependencies{"stun": ""}}, nil)
+	assert.Nil(t, compose.Update())
+	fakeExec.AssertExpectations(t)
+}
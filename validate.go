@@ -0,0 +1,173 @@
+package dockercompose
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+type ValidationProblem struct {
+	Service string
+	Network string
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	subjects := []string{}
+	if p.Service != "" {
+		subjects = append(subjects, "service "+p.Service)
+	}
+	if p.Network != "" {
+		subjects = append(subjects, "network "+p.Network)
+	}
+	if len(subjects) == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(subjects, ", "), p.Message)
+}
+
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		problems = append(problems, problem.String())
+	}
+	return fmt.Sprintf("invalid compose topology: %s", strings.Join(problems, "; "))
+}
+
+func (c *Compose) serviceNames() []string {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Compose) networkNames() []string {
+	names := make([]string, 0, len(c.Networks))
+	for name := range c.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Compose) Validate() []ValidationProblem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.validate()
+}
+
+func (c *Compose) validate() []ValidationProblem {
+	problems := []ValidationProblem{}
+	versionProblems, err := c.versionProblems()
+	if err != nil {
+		problems = append(problems, ValidationProblem{Message: err.Error()})
+	}
+	for _, problem := range versionProblems {
+		problems = append(problems, ValidationProblem{Message: fmt.Sprintf("compose file version %s does not support %s", c.Version, problem)})
+	}
+
+	subnets := map[string][]*net.IPNet{}
+	for _, name := range c.networkNames() {
+		network := c.Networks[name]
+		if network.ipamProblem != "" {
+			problems = append(problems, ValidationProblem{Network: name, Message: network.ipamProblem})
+		}
+		for _, cidr := range network.subnets() {
+			_, subnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				problems = append(problems, ValidationProblem{Network: name, Message: fmt.Sprintf("invalid subnet %s", cidr)})
+				continue
+			}
+			for _, otherName := range c.networkNames() {
+				for _, other := range subnets[otherName] {
+					if other.Contains(subnet.IP) || subnet.Contains(other.IP) {
+						problems = append(problems, ValidationProblem{Network: name, Message: fmt.Sprintf("subnet %s overlaps with network %s", cidr, otherName)})
+						break
+					}
+				}
+			}
+			subnets[name] = append(subnets[name], subnet)
+		}
+	}
+
+	addresses := map[string]map[string]string{}
+	for _, name := range c.serviceNames() {
+		service := c.Services[name]
+		if service.Image == "" && service.Build == nil {
+			problems = append(problems, ValidationProblem{Service: name, Message: "no image or build"})
+		}
+		if service.Build != nil && service.Build.ContextPath == "" && service.Build.Dockerfile == "" {
+			if _, found := service.Build.Context["Dockerfile"]; !found {
+				problems = append(problems, ValidationProblem{Service: name, Message: "build has no Dockerfile"})
+			}
+		}
+
+		for _, config := range service.serviceNetworksConfig {
+			if config.Network == nil {
+				problems = append(problems, ValidationProblem{Service: name, Message: "network config has no network"})
+				continue
+			}
+			networkName := config.Network.name
+			problem := func(message string, args ...interface{}) {
+				problems = append(problems, ValidationProblem{Service: name, Network: networkName, Message: fmt.Sprintf(message, args...)})
+			}
+			if config.Network.compose != c {
+				problem("network belongs to a different compose")
+				continue
+			}
+			if c.Networks[networkName] != config.Network {
+				problem("network is not registered")
+				continue
+			}
+
+			seen := map[string]bool{}
+			for _, alias := range config.Aliases {
+				if seen[alias] {
+					problem("duplicate alias %s", alias)
+				}
+				seen[alias] = true
+				if _, found := c.Services[alias]; found && alias != name {
+					problem("alias %s conflicts with service %s", alias, alias)
+				}
+			}
+
+			if config.IPv4Address == "" {
+				continue
+			}
+			ip := net.ParseIP(config.IPv4Address)
+			if ip == nil || ip.To4() == nil {
+				problem("invalid ipv4 address %s", config.IPv4Address)
+				continue
+			}
+			networkSubnets, found := subnets[networkName]
+			if !found {
+				problem("ipv4 address %s requires a network subnet", config.IPv4Address)
+				continue
+			}
+			contained := false
+			for _, subnet := range networkSubnets {
+				contained = contained || subnet.Contains(ip)
+			}
+			if !contained {
+				problem("ipv4 address %s is outside subnet %s", config.IPv4Address, strings.Join(config.Network.subnets(), ", "))
+				continue
+			}
+			if addresses[networkName] == nil {
+				addresses[networkName] = map[string]string{}
+			}
+			if other, found := addresses[networkName][ip.String()]; found {
+				problem("ipv4 address %s is already used by service %s", config.IPv4Address, other)
+				continue
+			}
+			addresses[networkName][ip.String()] = name
+		}
+	}
+	return append(problems, c.dependencyProblems()...)
+}
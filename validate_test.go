@@ -0,0 +1,108 @@
+package dockercompose
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+)
+
+func TestValidateValid(t *testing.T) {
+	compose, _, _ := mockCompose()
+	network := compose.AddNetwork("lan", NetworkConfig{Subnet: "10.0.0.0/24"})
+	compose.AddService("peer1", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, Aliases: []string{"peer"}, IPv4Address: "10.0.0.2"},
+	})
+	compose.AddService("peer2", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, Aliases: []string{"peer"}, IPv4Address: "10.0.0.3"},
+	})
+	assert.Equal(t, compose.Validate(), []ValidationProblem{})
+}
+
+func TestValidateProblems(t *testing.T) {
+	compose, _, _ := mockCompose()
+	other, _, _ := mockCompose()
+	foreign := other.AddNetwork("foreign", NetworkConfig{})
+	lan := compose.AddNetwork("lan", NetworkConfig{Subnet: "10.0.0.0/16"})
+	wan := compose.AddNetwork("wan", NetworkConfig{Subnet: "10.0.1.0/24"})
+	bad := compose.AddNetwork("bad", NetworkConfig{Subnet: "10.0.0.0"})
+	bare := compose.AddNetwork("bare", NetworkConfig{})
+
+	compose.AddService("empty", ServiceConfig{}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: foreign},
+	})
+	compose.AddService("peer1", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: lan, Aliases: []string{"a", "a", "peer2"}, IPv4Address: "10.0.0.2"},
+		ServiceNetworkConfig{Network: wan, IPv4Address: "192.168.0.2"},
+		ServiceNetworkConfig{Network: bare, IPv4Address: "172.16.0.2"},
+	})
+	compose.AddService("peer2", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: lan, IPv4Address: "10.0.0.2"},
+		ServiceNetworkConfig{Network: bad},
+	})
+
+	assert.Equal(t, compose.Validate(), []ValidationProblem{
+		ValidationProblem{Network: "bad", Message: "invalid subnet 10.0.0.0"},
+		ValidationProblem{Network: "wan", Message: "subnet 10.0.1.0/24 overlaps with network lan"},
+		ValidationProblem{Service: "empty", Message: "no image or build"},
+		ValidationProblem{Service: "empty", Network: "foreign", Message: "network belongs to a different compose"},
+		ValidationProblem{Service: "peer1", Network: "lan", Message: "duplicate alias a"},
+		ValidationProblem{Service: "peer1", Network: "lan", Message: "alias peer2 conflicts with service peer2"},
+		ValidationProblem{Service: "peer1", Network: "wan", Message: "ipv4 address 192.168.0.2 is outside subnet 10.0.1.0/24"},
+		ValidationProblem{Service: "peer1", Network: "bare", Message: "ipv4 address 172.16.0.2 requires a network subnet"},
+		ValidationProblem{Service: "peer2", Network: "lan", Message: "ipv4 address 10.0.0.2 is already used by service peer1"},
+	})
+}
+
+func TestValidateUnregisteredNetwork(t *testing.T) {
+	compose, _, _ := mockCompose()
+	network := &Network{name: "ghost", compose: compose}
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network},
+	})
+	assert.Equal(t, compose.Validate(), []ValidationProblem{
+		ValidationProblem{Service: "peer", Network: "ghost", Message: "network is not registered"},
+	})
+}
+
+func TestStartInvalid(t *testing.T) {
+	compose, fakeExec, fakeOS := mockCompose()
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("peer", ServiceConfig{}, nil)
+
+	err := compose.Start()
+	assert.Equal(t, err.Error(), "invalid compose topology: service peer: no image or build")
+	assert.Equal(t, err.(*ValidationError).Problems, []ValidationProblem{
+		ValidationProblem{Service: "peer", Message: "no image or build"},
+	})
+	assert.False(t, fakeOS.FileExists(compose.getTmpDir()))
+	fakeExec.AssertExpectations(t)
+}
+
+func TestRenderStaticAddressing(t *testing.T) {
+	compose, _, _ := mockCompose()
+	network := compose.AddNetwork("lan", NetworkConfig{Subnet: "10.0.0.0/24"})
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, []ServiceNetworkConfig{
+		ServiceNetworkConfig{Network: network, IPv4Address: "10.0.0.2"},
+	})
+
+	var out bytes.Buffer
+	assert.Nil(t, compose.Render(&out))
+	assert.Equal(t, out.String(), `version: "2.1"
+services:
+  peer:
+    image: ubuntu
+    privileged: false
+    container_name: peer
+    networks:
+      lan:
+        ipv4_address: 10.0.0.2
+networks:
+  lan:
+    ipam:
+      config:
+      - subnet: 10.0.0.0/24
+`)
+}
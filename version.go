@@ -0,0 +1,149 @@
+package dockercompose
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const ComposeSpecification = "compose-spec"
+
+type composeVersion struct {
+	major int
+	minor int
+	spec  bool
+}
+
+var maxMinorVersions = map[int]int{2: 4, 3: 8}
+
+func parseComposeVersion(version string) (composeVersion, error) {
+	if version == ComposeSpecification {
+		return composeVersion{spec: true}, nil
+	}
+	parts := strings.SplitN(version, ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return composeVersion{}, fmt.Errorf("unsupported compose file version %q", version)
+	}
+	minor := 0
+	if len(parts) == 2 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return composeVersion{}, fmt.Errorf("unsupported compose file version %q", version)
+		}
+	}
+	maxMinor, found := maxMinorVersions[major]
+	if !found || minor < 0 || minor > maxMinor {
+		return composeVersion{}, fmt.Errorf("unsupported compose file version %q", version)
+	}
+	return composeVersion{major: major, minor: minor}, nil
+}
+
+func (v composeVersion) supports(v2minor, v3minor int) bool {
+	switch {
+	case v.spec:
+		return true
+	case v.major == 2:
+		return v2minor >= 0 && v.minor >= v2minor
+	case v.major == 3:
+		return v3minor >= 0 && v.minor >= v3minor
+	}
+	return false
+}
+
+type versionFeature struct {
+	v2minor int
+	v3minor int
+}
+
+var topLevelFeatures = map[string]versionFeature{
+	"name":    versionFeature{-1, -1},
+	"secrets": versionFeature{-1, 1},
+	"configs": versionFeature{-1, 3},
+}
+
+var serviceFeatures = map[string]versionFeature{
+	"healthcheck":   versionFeature{1, 0},
+	"init":          versionFeature{2, 7},
+	"deploy":        versionFeature{-1, 0},
+	"secrets":       versionFeature{-1, 1},
+	"configs":       versionFeature{-1, 3},
+	"extends":       versionFeature{0, -1},
+	"volumes_from":  versionFeature{0, -1},
+	"cpu_shares":    versionFeature{0, -1},
+	"cpu_quota":     versionFeature{0, -1},
+	"cpuset":        versionFeature{0, -1},
+	"mem_limit":     versionFeature{0, -1},
+	"memswap_limit": versionFeature{0, -1},
+}
+
+var buildTargetFeature = versionFeature{3, 4}
+
+var dependencyConditionFeatures = map[DependencyCondition]versionFeature{
+	DependencyStarted:   versionFeature{1, -1},
+	DependencyHealthy:   versionFeature{1, -1},
+	DependencyCompleted: versionFeature{-1, -1},
+}
+
+func sortedExtraKeys(extra map[string]interface{}) []string {
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Compose) versionProblems() ([]string, error) {
+	version, err := parseComposeVersion(c.Version)
+	if err != nil {
+		return nil, err
+	}
+	unsupported := func(feature versionFeature) bool {
+		return !version.supports(feature.v2minor, feature.v3minor)
+	}
+
+	problems := []string{}
+	for _, key := range sortedExtraKeys(c.Extra) {
+		if feature, found := topLevelFeatures[key]; found && unsupported(feature) {
+			problems = append(problems, fmt.Sprintf("top-level key %s", key))
+		}
+	}
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		service := c.Services[name]
+		if service.Build != nil && service.Build.Target != "" && unsupported(buildTargetFeature) {
+			problems = append(problems, fmt.Sprintf("build target in service %s", name))
+		}
+		if service.DependsOn.longForm() {
+			for _, dependency := range service.DependsOn.names() {
+				condition := service.DependsOn.condition(dependency)
+				if feature, found := dependencyConditionFeatures[condition]; found && unsupported(feature) {
+					problems = append(problems, fmt.Sprintf("depends_on condition %s in service %s", condition, name))
+				}
+			}
+		}
+		for _, key := range sortedExtraKeys(service.Extra) {
+			if feature, found := serviceFeatures[key]; found && unsupported(feature) {
+				problems = append(problems, fmt.Sprintf("key %s in service %s", key, name))
+			}
+		}
+	}
+	return problems, nil
+}
+
+func (c *Compose) checkVersion() error {
+	problems, err := c.versionProblems()
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("compose file version %s does not support %s", c.Version, strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package dockercompose
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/seppo0010/vortices-dockercompose/exec"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseComposeVersion(t *testing.T) {
+	version, err := parseComposeVersion("2")
+	assert.Nil(t, err)
+	assert.Equal(t, version, composeVersion{major: 2, minor: 0})
+	version, err = parseComposeVersion("3.8")
+	assert.Nil(t, err)
+	assert.Equal(t, version, composeVersion{major: 3, minor: 8})
+	version, err = parseComposeVersion(ComposeSpecification)
+	assert.Nil(t, err)
+	assert.Equal(t, version, composeVersion{spec: true})
+
+	for _, invalid := range []string{"1", "2.5", "3.9", "latest", "3.x"} {
+		_, err = parseComposeVersion(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestRenderComposeSpecification(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.Version = ComposeSpecification
+	compose.Extra = map[string]interface{}{"name": "experiment"}
+	compose.AddService("peer", ServiceConfig{
+		Image: "ubuntu",
+		Build: &ServiceBuild{ContextPath: "/src", Target: "dev"},
+	}, nil)
+
+	var out bytes.Buffer
+	err := compose.Render(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, out.String(), `services:
+  peer:
+    image: ubuntu
+    privileged: false
+    build:
+      context: /src
+      target: dev
+    container_name: peer
+    networks: {}
+networks: {}
+name: experiment
+`)
+}
+
+func TestRenderIncompatibleVersion(t *testing.T) {
+	compose, _, _ := mockCompose()
+	compose.Version = "3.2"
+	compose.Extra = map[string]interface{}{"name": "experiment"}
+	service := compose.AddService("peer", ServiceConfig{
+		Build: &ServiceBuild{ContextPath: "/src", Target: "dev"},
+	}, nil)
+	service.Extra = map[string]interface{}{"mem_limit": "1g", "healthcheck": map[string]interface{}{}}
+
+	var out bytes.Buffer
+	err := compose.Render(&out)
+	assert.Equal(t, err.Error(), "compose file version 3.2 does not support top-level key name, build target in service peer, key mem_limit in service peer")
+}
+
+func TestStartUnsupportedVersion(t *testing.T) {
+	compose, fakeExec, _ := mockCompose()
+	compose.Version = "1"
+	fakeExec.Expect("docker-compose", exec.AnyArgs()).Times(0)
+	compose.AddService("peer", ServiceConfig{Image: "ubuntu"}, nil)
+
+	err := compose.Start()
+	assert.Equal(t, err.Error(), `invalid compose topology: unsupported compose file version "1"`)
+	fakeExec.AssertExpectations(t)
+	assert.Equal(t, compose.status, composeStatusSetup)
+}